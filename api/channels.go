@@ -0,0 +1,326 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// handleCreateChannel handles the POST /conversations/channel endpoint.
+// The creator becomes the owner of the channel and its first subscriber.
+func (s *APIServer) handleCreateChannel(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string  `json:"name"`
+		Description *string `json:"description"`
+		AvatarURL   *string `json:"avatar_url"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	metadata := data.GroupMetadata{
+		OwnerID:     s.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		AvatarURL:   input.AvatarURL,
+		// Anyone who knows a channel can subscribe to it.
+		Visibility: data.GroupVisibilityPublic,
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroupMetadata(v, metadata); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	channel := data.Conversation{
+		Type:          data.ConversationTypeChannel,
+		GroupMetadata: &metadata,
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.Conversation.CreateGroup(r.Context(), &channel)
+	})
+
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"channel": channel}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleSubscribeChannel handles the POST /conversations/channel/:channel_id/subscribe endpoint.
+// Unlike joining a group, subscribing isn't announced to the other subscribers.
+func (s *APIServer) handleSubscribeChannel(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	channelID := s.readUUIDParam("channel_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	channelExists, err := s.models.Conversation.Exists(r.Context(), *channelID, data.ConversationTypeChannel)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !channelExists {
+		s.notFoundResponse(w, r)
+		return
+	}
+
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *channelID); err != nil {
+			return err
+		}
+
+		return tx.ConversationParticipant.Subscribe(r.Context(), *channelID, user.ID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConversationParticipantDuplicate):
+			v.AddError("channel_id", "already subscribed")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrNoRecordFound), errors.Is(err, data.ErrConversationDoesNotExist):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	channel, err := s.models.Conversation.Get(r.Context(), *channelID, data.ConversationTypeChannel)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"channel": channel}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// errChannelOwner is returned from transactions unsubscribing the owner of a channel.
+var errChannelOwner = errors.New("channel owner")
+
+// handleUnsubscribeChannel handles the POST /conversations/channel/:channel_id/unsubscribe endpoint.
+// The owner can't unsubscribe from their own channel.
+func (s *APIServer) handleUnsubscribeChannel(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	channelID := s.readUUIDParam("channel_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *channelID); err != nil {
+			return err
+		}
+
+		// The role is read under the lock in case ownership changed concurrently.
+		role, err := tx.ConversationParticipant.GetRole(r.Context(), user.ID, *channelID, data.ConversationTypeChannel)
+		if err != nil {
+			return err
+		}
+
+		if role == data.RoleOwner {
+			return errChannelOwner
+		}
+
+		return tx.ConversationParticipant.Unsubscribe(r.Context(), *channelID, user.ID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errChannelOwner):
+			v.AddError("channel_id", "must not be owned by the current user")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListChannelSubscribers handles the GET /conversations/channel/:channel_id/subscribers endpoint.
+// Subscribers don't see each other, so it's only available to the owner and admins.
+func (s *APIServer) handleListChannelSubscribers(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	channelID := s.readUUIDParam("channel_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeParticipant(w, r, data.ConversationTypeChannel, *channelID, user.ID, data.PermissionViewSubscribers); !ok {
+		return
+	}
+
+	search := s.readStringQuery(r.URL.Query(), "search", "")
+
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 20, v),
+		Sort:         s.readStringQuery(r.URL.Query(), "sort", "role"),
+		SortSafeList: []string{"role", "-role", "username", "-username", "joined_at", "-joined_at"},
+	}
+
+	v.Check(len(search) <= 100, "search", "must not be more than 100 bytes long")
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	subscribers, paginationMetadata, err := s.models.ConversationParticipant.GetAllForGroup(r.Context(), *channelID, search, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"subscribers": subscribers, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handlePromoteChannelSubscriber handles the POST /conversations/channel/:channel_id/subscribers/:user_id/promote endpoint.
+// It makes a subscriber an admin of the channel, who can post to it.
+func (s *APIServer) handlePromoteChannelSubscriber(w http.ResponseWriter, r *http.Request) {
+	s.changeParticipantRole(w, r, data.ConversationTypeChannel, data.RoleMember, data.RoleAdmin)
+}
+
+// handleDemoteChannelSubscriber handles the POST /conversations/channel/:channel_id/subscribers/:user_id/demote endpoint.
+func (s *APIServer) handleDemoteChannelSubscriber(w http.ResponseWriter, r *http.Request) {
+	s.changeParticipantRole(w, r, data.ConversationTypeChannel, data.RoleAdmin, data.RoleMember)
+}
+
+// handleListChannelMessages handles the GET /conversations/channel/:channel_id/messages endpoint.
+// It's available to subscribers, along with the channel and its subscriber count.
+func (s *APIServer) handleListChannelMessages(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	channelID := s.readUUIDParam("channel_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	isSubscribed, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *channelID, data.ConversationTypeChannel)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !isSubscribed {
+		s.notFoundResponse(w, r)
+		return
+	}
+
+	channel, err := s.models.Conversation.Get(r.Context(), *channelID, data.ConversationTypeChannel)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 10, v),
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForGroup(r.Context(), *channelID, user.ID, f)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Subscribers aren't participants the posters chose to share their emails with.
+	for _, m := range messages {
+		if m.Sender != nil {
+			m.Sender.Email = ""
+		}
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"channel": channel, "messages": messages, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleCreateChannelMessage handles the POST /conversations/channel/:channel_id/messages endpoint.
+// Only the owner and admins can post, the other subscribers can only read.
+func (s *APIServer) handleCreateChannelMessage(w http.ResponseWriter, r *http.Request) {
+	var input messageInput
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	channelID := s.readUUIDParam("channel_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeParticipant(w, r, data.ConversationTypeChannel, *channelID, user.ID, data.PermissionPostToChannel); !ok {
+		return
+	}
+
+	s.createMessage(w, r, v, &input, *channelID, data.ConversationTypeChannel, data.PermissionPostToChannel, 0)
+}
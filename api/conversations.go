@@ -1,8 +1,13 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thisisjab/gchat-go/internal/data"
@@ -10,8 +15,228 @@ import (
 	"github.com/thisisjab/gchat-go/internal/validator"
 )
 
+// messageInput is the request body accepted by the endpoints creating messages.
+type messageInput struct {
+	ClientMessageID  *string    `json:"client_message_id"`
+	Type             string     `json:"type"`
+	Format           string     `json:"format"`
+	Content          string     `json:"content"`
+	RepliedMessageID *uuid.UUID `json:"replied_message_id"`
+	Poll             *struct {
+		Question       string     `json:"question"`
+		Options        []string   `json:"options"`
+		MultipleChoice bool       `json:"multiple_choice"`
+		Anonymous      bool       `json:"anonymous"`
+		ClosesAt       *time.Time `json:"closes_at"`
+	} `json:"poll"`
+	Location *data.Location `json:"location"`
+	Contact  *struct {
+		UserID *uuid.UUID `json:"user_id"`
+		VCard  *string    `json:"vcard"`
+	} `json:"contact"`
+}
+
+// message builds a message sent by senderID in the given conversation from the input.
+// Formatted content is parsed into plain text and entities; parse errors are added to v.
+// Content is checked against maxContentLength before it's parsed, so huge inputs are never parsed.
+func (input *messageInput) message(v *validator.Validator, conversationID, senderID uuid.UUID, maxContentLength int) *data.ConversationMessage {
+	msg := &data.ConversationMessage{
+		ConversationID:   conversationID,
+		SenderID:         &senderID,
+		ClientMessageID:  input.ClientMessageID,
+		Content:          input.Content,
+		Type:             input.Type,
+		Format:           input.Format,
+		RepliedMessageID: input.RepliedMessageID,
+		Location:         input.Location,
+	}
+
+	if input.Contact != nil {
+		msg.Contact = &data.Contact{UserID: input.Contact.UserID, VCard: input.Contact.VCard}
+	}
+
+	if input.Poll != nil {
+		msg.Poll = &data.Poll{
+			Question:       input.Poll.Question,
+			Options:        make([]*data.PollOption, 0, len(input.Poll.Options)),
+			MultipleChoice: input.Poll.MultipleChoice,
+			Anonymous:      input.Poll.Anonymous,
+			ClosesAt:       input.Poll.ClosesAt,
+		}
+
+		for _, option := range input.Poll.Options {
+			msg.Poll.Options = append(msg.Poll.Options, &data.PollOption{Text: option})
+		}
+
+		// The question doubles as the content so previews of polls stay meaningful.
+		if msg.Content == "" {
+			msg.Content = input.Poll.Question
+		}
+	}
+
+	if msg.Format == "" {
+		msg.Format = data.FormatPlain
+	}
+
+	if err := msg.ParseFormat(maxContentLength); err != nil {
+		switch {
+		case errors.Is(err, data.ErrContentTooLong):
+			v.AddError("content", fmt.Sprintf("must not be more than %d characters long", maxContentLength))
+		default:
+			v.AddError("content", err.Error())
+		}
+	}
+
+	return msg
+}
+
+// slowModeError is returned from transactions inserting a message sooner than slow mode allows.
+type slowModeError struct {
+	wait time.Duration
+}
+
+func (e *slowModeError) Error() string {
+	return fmt.Sprintf("slow mode: retry in %s", e.wait)
+}
+
+// insertMessage inserts a message in a transaction since some message types span multiple tables.
+// The sender's draft in the conversation is cleared as the message supersedes it.
+// Like every transaction inserting messages or participants, it locks the conversation first so they all take locks
+// in the same order. With a slow mode interval, the previous message of the sender is checked under the lock,
+// so concurrent messages can't both pass; a *slowModeError is returned if it was sent too recently.
+// With a permission, the sender's role is read under the lock too, so a sender demoted concurrently can't post;
+// errPermissionDenied is returned if their role doesn't grant it.
+func (s *APIServer) insertMessage(ctx context.Context, msg *data.ConversationMessage, conversationType string, permission data.Permission, slowModeInterval time.Duration) error {
+	return s.models.Transaction(ctx, func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(ctx, msg.ConversationID); err != nil {
+			return err
+		}
+
+		if permission != "" {
+			role, err := tx.ConversationParticipant.GetRole(ctx, *msg.SenderID, msg.ConversationID, conversationType)
+			if err != nil {
+				return err
+			}
+
+			if !data.RoleHasPermission(role, permission) {
+				return errPermissionDenied
+			}
+		}
+
+		if slowModeInterval > 0 {
+			lastSentAt, err := tx.ConversationMessage.GetLastSentAt(ctx, msg.ConversationID, *msg.SenderID)
+
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+			case err != nil:
+				return err
+			default:
+				if wait := time.Until(lastSentAt.Add(slowModeInterval)); wait > 0 {
+					return &slowModeError{wait: wait}
+				}
+			}
+		}
+
+		if err := tx.ConversationMessage.Insert(ctx, msg); err != nil {
+			return err
+		}
+
+		return tx.ConversationDraft.Delete(ctx, *msg.SenderID, msg.ConversationID)
+	})
+}
+
+// createMessage validates the input as a message of the current user in the given conversation,
+// inserts it and writes the response. Access to the conversation must be checked beforehand.
+// If a permission is given, the user's role must still grant it when the message is inserted.
+// If the user is posting faster than the slow mode interval allows, too many requests is written with a Retry-After header.
+func (s *APIServer) createMessage(w http.ResponseWriter, r *http.Request, v *validator.Validator, input *messageInput, conversationID uuid.UUID, conversationType string, permission data.Permission, slowModeInterval time.Duration) {
+	user := s.contextGetUser(r)
+
+	// Prepare and validate message before inserting
+	msg := input.message(v, conversationID, user.ID, s.config.Messages.MaxContentLength)
+
+	data.ValidateConversationMessage(v, msg, s.config.Messages.MaxContentLength)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	// Check replied message exists
+	if input.RepliedMessageID != nil {
+		msgExists, err := s.models.ConversationMessage.BelongsToConversation(r.Context(), *input.RepliedMessageID, conversationID, conversationType)
+
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+
+			return
+		}
+
+		v.Check(msgExists, "replied_message_id", "does not exist")
+	}
+
+	// Check shared contact exists
+	if msg.Contact != nil && msg.Contact.UserID != nil {
+		v.Check(s.models.User.ExistsByID(r.Context(), *msg.Contact.UserID), "contact.user_id", "does not exist")
+	}
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.insertMessage(r.Context(), msg, conversationType, permission, slowModeInterval)
+	if err != nil {
+		var slowModeErr *slowModeError
+
+		switch {
+		case errors.Is(err, data.ErrConversationMessageDuplicate):
+			s.replayCreatedMessage(w, r, msg)
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		case errors.As(err, &slowModeErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(slowModeErr.wait.Seconds()))))
+			s.rateLimitExceededResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	s.unfurlMessage(msg)
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"message": msg}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// replayCreatedMessage responds to a retried message creation with the message originally created
+// with the same client message id.
+func (s *APIServer) replayCreatedMessage(w http.ResponseWriter, r *http.Request, msg *data.ConversationMessage) {
+	original, err := s.models.ConversationMessage.GetByClientMessageID(r.Context(), *msg.SenderID, *msg.ClientMessageID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if original.ConversationID != msg.ConversationID {
+		v := validator.New()
+		v.AddError("client_message_id", "has already been used for another message")
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"message": original}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
 // handleListConversations handles the GET /conversations endpoint.
-// It lists all conversations (group/private) for the authenticated user.
+// It lists all conversations (self/group/private/channel) for the authenticated user, with saved messages and then pinned ones on top.
+// Archived conversations are only listed, on their own, with archived=true, and folder_id only lists the conversations in the folder.
 func (s *APIServer) handleListConversations(w http.ResponseWriter, r *http.Request) {
 	user := s.contextGetUser(r)
 
@@ -21,6 +246,19 @@ func (s *APIServer) handleListConversations(w http.ResponseWriter, r *http.Reque
 		PageSize: s.readIntQuery(r.URL.Query(), "page_size", 10, v),
 	}
 
+	archived := s.readBoolQuery(r.URL.Query(), "archived", false, v)
+
+	var folderID *uuid.UUID
+
+	if value := r.URL.Query().Get("folder_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			v.AddError("folder_id", "invalid uuid")
+		}
+
+		folderID = &id
+	}
+
 	if !v.Valid() {
 		s.failedValidationResponse(w, r, v.Errors())
 		return
@@ -32,7 +270,21 @@ func (s *APIServer) handleListConversations(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	conversations, paginationMetadata, err := s.models.Conversation.GetAllWithPreview(r.Context(), user.ID, f)
+	if folderID != nil {
+		_, err := s.models.ConversationFolder.Get(r.Context(), *folderID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				v.AddError("folder_id", "does not exist")
+				s.failedValidationResponse(w, r, v.Errors())
+			default:
+				s.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	conversations, paginationMetadata, err := s.models.Conversation.GetAllWithPreview(r.Context(), user.ID, archived, folderID, f)
 	if err != nil {
 		switch {
 		case errors.Is(err, filter.InvalidPageError):
@@ -78,6 +330,12 @@ func (s *APIServer) handleListPrivateConversationMessages(w http.ResponseWriter,
 		return
 	}
 
+	// A private conversation with oneself is the "saved messages" conversation.
+	if *otherUserID == user.ID {
+		s.handleListSelfMessages(w, r)
+		return
+	}
+
 	// Check other user exists
 	otherUser, err := s.models.User.GetByID(r.Context(), *otherUserID)
 
@@ -93,13 +351,18 @@ func (s *APIServer) handleListPrivateConversationMessages(w http.ResponseWriter,
 
 	// Get the conversation
 	// If conversation doesn't exist, client just sees an empty list of messages
+	conversationID := uuid.Nil
+
 	conversation, err := s.models.Conversation.GetPrivateBetweenUsers(r.Context(), user.ID, *otherUserID)
-	if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+	switch {
+	case err == nil:
+		conversationID = conversation.ID
+	case !errors.Is(err, data.ErrNoRecordFound):
 		s.serverErrorResponse(w, r, err)
 		return
 	}
 
-	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForPrivate(r.Context(), conversation.ID, f)
+	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForPrivate(r.Context(), conversationID, user.ID, f)
 
 	if err != nil {
 		switch {
@@ -120,11 +383,7 @@ func (s *APIServer) handleListPrivateConversationMessages(w http.ResponseWriter,
 // handleCreatePrivateMessage handles the POST /conversations/private/:other_user_id/messages endpoint.
 // It creates a new message in a private chat if `other_user_id` is a valid user id.
 func (s *APIServer) handleCreatePrivateMessage(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Type             string     `json:"type"`
-		Content          string     `json:"content"`
-		RepliedMessageID *uuid.UUID `json:"replied_message_id"`
-	}
+	var input messageInput
 
 	if err := s.readJSON(w, r, &input); err != nil {
 		s.badRequestResponse(w, r, err)
@@ -141,6 +400,18 @@ func (s *APIServer) handleCreatePrivateMessage(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// A private conversation with oneself is the "saved messages" conversation.
+	if *otherUserID == user.ID {
+		conversation, err := s.selfConversation(r.Context(), user.ID)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return
+		}
+
+		s.createMessage(w, r, v, &input, conversation.ID, data.ConversationTypeSelf, "", 0)
+		return
+	}
+
 	// Check other user exists
 	if otherUserExists := s.models.User.ExistsByID(r.Context(), *otherUserID); !otherUserExists {
 		s.notFoundResponse(w, r)
@@ -154,7 +425,10 @@ func (s *APIServer) handleCreatePrivateMessage(w http.ResponseWriter, r *http.Re
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
 			// If conversation doesn't exist, create it.
-			conversation, err = s.models.Conversation.CreateBetweenUsers(r.Context(), user.ID, *otherUserID)
+			err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+				conversation, err = tx.Conversation.CreateBetweenUsers(r.Context(), user.ID, *otherUserID)
+				return err
+			})
 
 			if err != nil {
 				s.serverErrorResponse(w, r, err)
@@ -166,48 +440,87 @@ func (s *APIServer) handleCreatePrivateMessage(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	// Prepare and validate message before inserting
-	msg := &data.ConversationMessage{
-		ConversationID:   conversation.ID,
-		SenderID:         user.ID,
-		Content:          input.Content,
-		Type:             input.Type,
-		RepliedMessageID: input.RepliedMessageID,
+	s.createMessage(w, r, v, &input, conversation.ID, data.ConversationTypePrivate, "", 0)
+}
+
+// selfConversation returns the "saved messages" conversation of the user, creating it on first use.
+func (s *APIServer) selfConversation(ctx context.Context, userID uuid.UUID) (*data.Conversation, error) {
+	conversation, err := s.models.Conversation.GetSelf(ctx, userID)
+	if !errors.Is(err, data.ErrNoRecordFound) {
+		return conversation, err
 	}
 
-	data.ValidateConversationMessage(v, msg)
-	if !v.Valid() {
+	err = s.models.Transaction(ctx, func(tx *data.Models) error {
+		conversation, err = tx.Conversation.CreateSelf(ctx, userID)
+		return err
+	})
+
+	// Another request may have created it in the meantime.
+	if errors.Is(err, data.ErrSelfConversationDuplicate) {
+		return s.models.Conversation.GetSelf(ctx, userID)
+	}
+
+	return conversation, err
+}
+
+// handleListSelfMessages handles the GET /conversations/self/messages endpoint.
+// It lists the messages of the current user's "saved messages" conversation, which is created on first use.
+func (s *APIServer) handleListSelfMessages(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+	f := filter.Filters{
+		Page:     s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize: s.readIntQuery(r.URL.Query(), "page_size", 10, v),
+	}
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
 		s.failedValidationResponse(w, r, v.Errors())
 		return
 	}
 
-	// Check replied message exists
-	if input.RepliedMessageID != nil {
-		msgExists, err := s.models.ConversationMessage.BelongsToConversation(r.Context(), *input.RepliedMessageID, conversation.ID, data.ConversationTypePrivate)
+	conversation, err := s.selfConversation(r.Context(), user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
 
-		if err != nil {
+	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForPrivate(r.Context(), conversation.ID, user.ID, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
 			s.serverErrorResponse(w, r, err)
-
-			return
 		}
-
-		v.Check(msgExists, "replied_message_id", "does not exist")
+		return
 	}
 
-	if !v.Valid() {
-		s.failedValidationResponse(w, r, v.Errors())
+	if err := s.writeJSON(w, http.StatusOK, envelope{"conversation": conversation, "messages": messages, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
 		return
 	}
+}
 
-	if err := s.models.ConversationMessage.Insert(r.Context(), msg); err != nil {
-		s.serverErrorResponse(w, r, err)
+// handleCreateSelfMessage handles the POST /conversations/self/messages endpoint.
+// It creates a message in the current user's "saved messages" conversation, which is created on first use.
+func (s *APIServer) handleCreateSelfMessage(w http.ResponseWriter, r *http.Request) {
+	var input messageInput
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
 		return
 	}
 
-	if err := s.writeJSON(w, http.StatusCreated, envelope{"message": msg}, nil); err != nil {
+	user := s.contextGetUser(r)
+
+	conversation, err := s.selfConversation(r.Context(), user.ID)
+	if err != nil {
 		s.serverErrorResponse(w, r, err)
 		return
 	}
+
+	s.createMessage(w, r, validator.New(), &input, conversation.ID, data.ConversationTypeSelf, "", 0)
 }
 
 // handleListGroupMessages handles the GET /conversations/groups/:group_id/messages endpoint.
@@ -236,6 +549,17 @@ func (s *APIServer) handleListGroupMessages(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	f := filter.Filters{
 		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
 		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 10, v),
@@ -250,14 +574,13 @@ func (s *APIServer) handleListGroupMessages(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForGroup(r.Context(), *groupID, f)
+	messages, paginationMetadata, err := s.models.ConversationMessage.GetAllForGroup(r.Context(), *groupID, user.ID, f)
 	if err != nil {
 		s.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// TODO: include `group` in response.
-	if err := s.writeJSON(w, http.StatusOK, envelope{"messages": messages, "pagination": paginationMetadata}, nil); err != nil {
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group, "messages": messages, "pagination": paginationMetadata}, groupETag(group)); err != nil {
 		s.serverErrorResponse(w, r, err)
 		return
 	}
@@ -266,11 +589,7 @@ func (s *APIServer) handleListGroupMessages(w http.ResponseWriter, r *http.Reque
 // handleCreateGroupMessage handles the POST /conversations/group/:group_id/messages endpoint.
 // It creates a new message in a group chat if group exists and current user is a member of the group.
 func (s *APIServer) handleCreateGroupMessage(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Type             string     `json:"type"`
-		Content          string     `json:"content"`
-		RepliedMessageID *uuid.UUID `json:"replied_message_id"`
-	}
+	var input messageInput
 
 	if err := s.readJSON(w, r, &input); err != nil {
 		s.badRequestResponse(w, r, err)
@@ -300,66 +619,78 @@ func (s *APIServer) handleCreateGroupMessage(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check user is a member of group.
-	isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+	role, err := s.models.ConversationParticipant.GetRole(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
 	if err != nil {
-		s.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	if !isParticipant {
-		s.permissionDeniedResponse(w, r)
+	slowModeInterval, ok := s.checkGroupPostingAllowed(w, r, *groupID, user.ID, role, input.Type)
+	if !ok {
 		return
 	}
 
-	// Prepare and validate message before inserting
-	msg := &data.ConversationMessage{
-		ConversationID:   *groupID,
-		SenderID:         user.ID,
-		Content:          input.Content,
-		Type:             input.Type,
-		RepliedMessageID: input.RepliedMessageID,
-	}
+	s.createMessage(w, r, v, &input, *groupID, data.ConversationTypeGroup, "", slowModeInterval)
+}
 
-	data.ValidateConversationMessage(v, msg)
-	if !v.Valid() {
-		s.failedValidationResponse(w, r, v.Errors())
-		return
+// checkGroupPostingAllowed enforces mutes and the settings of the group on a message of the given type by the participant.
+// If they can't post it, permission denied is written, as they are muted or their role is not allowed to send it.
+// Otherwise it returns the slow mode interval applying to them, which is enforced when the message is inserted.
+func (s *APIServer) checkGroupPostingAllowed(w http.ResponseWriter, r *http.Request, groupID, userID uuid.UUID, role, messageType string) (time.Duration, bool) {
+	muted, err := s.models.GroupRestriction.IsRestricted(r.Context(), groupID, userID, data.RestrictionMute)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return 0, false
 	}
 
-	// Check replied message exists
-	if input.RepliedMessageID != nil {
-		msgExists, err := s.models.ConversationMessage.BelongsToConversation(r.Context(), *input.RepliedMessageID, *groupID, data.ConversationTypeGroup)
+	if muted {
+		s.permissionDeniedResponse(w, r)
+		return 0, false
+	}
 
-		if err != nil {
+	settings, err := s.models.Conversation.GetGroupSettings(r.Context(), groupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
 			s.serverErrorResponse(w, r, err)
-
-			return
 		}
-
-		v.Check(msgExists, "replied_message_id", "does not exist")
+		return 0, false
 	}
 
-	if !v.Valid() {
-		s.failedValidationResponse(w, r, v.Errors())
-		return
+	if !data.AudienceIncludes(settings.SendMessages, role) {
+		s.permissionDeniedResponse(w, r)
+		return 0, false
 	}
 
-	if err := s.models.ConversationMessage.Insert(r.Context(), msg); err != nil {
-		s.serverErrorResponse(w, r, err)
-		return
+	if data.IsMediaMessage(messageType) && !data.AudienceIncludes(settings.SendMedia, role) {
+		s.permissionDeniedResponse(w, r)
+		return 0, false
 	}
 
-	if err := s.writeJSON(w, http.StatusCreated, envelope{"message": msg}, nil); err != nil {
-		s.serverErrorResponse(w, r, err)
-		return
+	// Slow mode only applies to regular members, like the other settings.
+	if role != data.RoleMember {
+		return 0, true
 	}
+
+	return time.Duration(settings.SlowModeInterval) * time.Second, true
 }
 
 // handleCreateGroup handles the POST /conversations/group endpoint.
 // It creates a group.
+
 func (s *APIServer) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name string `json:"name"`
+		Name        string  `json:"name"`
+		Description *string `json:"description"`
+		AvatarURL   *string `json:"avatar_url"`
+		Visibility  string  `json:"visibility"`
 	}
 
 	if err := s.readJSON(w, r, &input); err != nil {
@@ -369,8 +700,15 @@ func (s *APIServer) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	groupMetadata := data.GroupMetadata{
-		OwnerID: s.contextGetUser(r).ID,
-		Name:    input.Name,
+		OwnerID:     s.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		AvatarURL:   input.AvatarURL,
+		Visibility:  input.Visibility,
+	}
+
+	if groupMetadata.Visibility == "" {
+		groupMetadata.Visibility = data.GroupVisibilityPrivate
 	}
 
 	v := validator.New()
@@ -387,14 +725,21 @@ func (s *APIServer) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
 		GroupMetadata: &groupMetadata,
 	}
 
-	err := s.models.Conversation.CreateGroup(r.Context(), &group)
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.CreateGroup(r.Context(), &group); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(group.ID, groupMetadata.OwnerID, data.EventGroupCreated, nil))
+	})
+
 	if err != nil {
 		s.serverErrorResponse(w, r, err)
 
 		return
 	}
 
-	if err := s.writeJSON(w, http.StatusCreated, envelope{"group": group}, nil); err != nil {
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"group": group}, groupETag(&group)); err != nil {
 		s.serverErrorResponse(w, r, err)
 
 		return
@@ -414,7 +759,7 @@ func (s *APIServer) handleAddGroupParticipant(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	role, err := s.models.ConversationParticipant.GetRole(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
@@ -422,14 +767,23 @@ func (s *APIServer) handleAddGroupParticipant(w http.ResponseWriter, r *http.Req
 		default:
 			s.serverErrorResponse(w, r, err)
 		}
+		return
+	}
 
+	settings, err := s.models.Conversation.GetGroupSettings(r.Context(), *groupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	// Check if current user is owner of group before proceeding
-	if group.GroupMetadata.OwnerID != user.ID {
+	// Groups can let every member add others, otherwise it takes the add members permission.
+	if settings.AddMembers != data.GroupAudienceEveryone && !data.RoleHasPermission(role, data.PermissionAddMembers) {
 		s.permissionDeniedResponse(w, r)
-
 		return
 	}
 
@@ -443,14 +797,32 @@ func (s *APIServer) handleAddGroupParticipant(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = s.models.ConversationParticipant.AddParticipant(r.Context(), groupID, &input.ParticipantID)
+	// The group is locked so a concurrent ban can't miss the added user, and vice versa.
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		if err := tx.ConversationParticipant.AddParticipant(r.Context(), groupID, &input.ParticipantID, s.config.Groups.MaxMembers); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventParticipantAdded, &input.ParticipantID))
+	})
 
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+			return
 		case errors.Is(err, data.ErrUserDoesNotExist):
 			v.AddError("user_id", "does not exist")
 		case errors.Is(err, data.ErrConversationParticipantDuplicate):
 			v.AddError("user_id", "already a participant")
+		case errors.Is(err, data.ErrConversationParticipantBanned):
+			v.AddError("user_id", "is banned from the group")
+		case errors.Is(err, data.ErrGroupFull):
+			v.AddError("group_id", "is full")
 		default:
 			s.serverErrorResponse(w, r, err)
 			return
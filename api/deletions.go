@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// conversationPurgeBatchSize is how many messages of a deleted conversation are deleted at a time.
+const conversationPurgeBatchSize = 1000
+
+// purgeConversation deletes what's left of a deleted conversation in the background, in batches,
+// so deleting large conversations doesn't hold locks on their messages for long.
+// It stops between batches on shutdown, leaving the rest to purgeDeletedConversations on the next start.
+func (s *APIServer) purgeConversation(conversationID uuid.UUID) {
+	s.background(func() {
+		for s.stopping.Err() == nil {
+			done, err := s.models.Conversation.PurgeBatch(s.stopping, conversationID, conversationPurgeBatchSize)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					s.logger.Error(fmt.Sprintf("error while purging conversation %s: %v", conversationID, err))
+				}
+				return
+			}
+
+			if done {
+				return
+			}
+		}
+	})
+}
+
+// purgeDeletedConversations resumes purging the conversations whose purge was interrupted, e.g. by a restart.
+func (s *APIServer) purgeDeletedConversations() {
+	conversationIDs, err := s.models.Conversation.GetAllDeletedIDs(context.Background())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("error while listing deleted conversations: %v", err))
+		return
+	}
+
+	for _, conversationID := range conversationIDs {
+		s.purgeConversation(conversationID)
+	}
+}
+
+// clearHistory handles POST requests on the clear endpoints of all conversation types.
+// It hides the messages sent until now from the current user only.
+func (s *APIServer) clearHistory(w http.ResponseWriter, r *http.Request, conversationType string) {
+	conversationID, _, ok := s.participantConversationFromRequest(w, r, conversationType)
+	if !ok {
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationPreferences.ClearHistory(r.Context(), conversationID, s.contextGetUser(r).ID)
+	})
+
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClearPrivateHistory handles the POST /conversations/private/:other_user_id/clear endpoint.
+func (s *APIServer) handleClearPrivateHistory(w http.ResponseWriter, r *http.Request) {
+	s.clearHistory(w, r, data.ConversationTypePrivate)
+}
+
+// handleClearGroupHistory handles the POST /conversations/group/:group_id/clear endpoint.
+func (s *APIServer) handleClearGroupHistory(w http.ResponseWriter, r *http.Request) {
+	s.clearHistory(w, r, data.ConversationTypeGroup)
+}
+
+// handleClearChannelHistory handles the POST /conversations/channel/:channel_id/clear endpoint.
+func (s *APIServer) handleClearChannelHistory(w http.ResponseWriter, r *http.Request) {
+	s.clearHistory(w, r, data.ConversationTypeChannel)
+}
+
+// handleClearSelfHistory handles the POST /conversations/self/clear endpoint.
+func (s *APIServer) handleClearSelfHistory(w http.ResponseWriter, r *http.Request) {
+	s.clearHistory(w, r, data.ConversationTypeSelf)
+}
+
+// handleDeletePrivateConversation handles the DELETE /conversations/private/:other_user_id endpoint.
+// It deletes the conversation for both users, if deleting for both is allowed.
+// Messaging the other user afterwards starts a new conversation.
+func (s *APIServer) handleDeletePrivateConversation(w http.ResponseWriter, r *http.Request) {
+	if !s.config.Conversations.AllowDeleteForBoth {
+		s.permissionDeniedResponse(w, r)
+		return
+	}
+
+	conversationID, conversationType, ok := s.participantConversationFromRequest(w, r, data.ConversationTypePrivate)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(conversationType == data.ConversationTypePrivate, "other_user_id", "must not be the current user"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.Conversation.MarkDeleted(r.Context(), conversationID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	s.purgeConversation(conversationID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteGroup handles the DELETE /conversations/group/:group_id endpoint.
+// Only the owner can delete the group, which removes all of its participants and messages.
+func (s *APIServer) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionDeleteGroup); !ok {
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		// Ownership may have been transferred since the user was authorized.
+		role, err := tx.ConversationParticipant.GetRole(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+		if err != nil {
+			return err
+		}
+
+		if !data.RoleHasPermission(role, data.PermissionDeleteGroup) {
+			return errPermissionDenied
+		}
+
+		return tx.Conversation.MarkDeleted(r.Context(), *groupID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	s.purgeConversation(*groupID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
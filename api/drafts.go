@@ -0,0 +1,201 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// participantConversationFromRequest resolves the conversation a draft or preferences endpoint refers to, in which the user participates.
+// Private conversations must already exist, so drafting a first message doesn't reveal a conversation to the other user.
+// The resolved conversation type is returned as well since a private conversation with oneself is a self conversation.
+// If false is returned, a response has already been written.
+func (s *APIServer) participantConversationFromRequest(w http.ResponseWriter, r *http.Request, conversationType string) (uuid.UUID, string, bool) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	switch conversationType {
+	case data.ConversationTypeSelf:
+		conversation, err := s.selfConversation(r.Context(), user.ID)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return uuid.Nil, "", false
+		}
+
+		return conversation.ID, conversationType, true
+
+	case data.ConversationTypePrivate:
+		otherUserID := s.readUUIDParam("other_user_id", r, v)
+		if !v.Valid() {
+			s.failedValidationResponse(w, r, v.Errors())
+			return uuid.Nil, "", false
+		}
+
+		if *otherUserID == user.ID {
+			return s.participantConversationFromRequest(w, r, data.ConversationTypeSelf)
+		}
+
+		conversation, err := s.models.Conversation.GetPrivateBetweenUsers(r.Context(), user.ID, *otherUserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				s.notFoundResponse(w, r)
+			default:
+				s.serverErrorResponse(w, r, err)
+			}
+			return uuid.Nil, "", false
+		}
+
+		return conversation.ID, conversationType, true
+
+	case data.ConversationTypeChannel:
+		channelID := s.readUUIDParam("channel_id", r, v)
+		if !v.Valid() {
+			s.failedValidationResponse(w, r, v.Errors())
+			return uuid.Nil, "", false
+		}
+
+		isSubscribed, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *channelID, data.ConversationTypeChannel)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return uuid.Nil, "", false
+		}
+
+		if !isSubscribed {
+			s.notFoundResponse(w, r)
+			return uuid.Nil, "", false
+		}
+
+		return *channelID, conversationType, true
+
+	default:
+		groupID := s.readUUIDParam("group_id", r, v)
+		if !v.Valid() {
+			s.failedValidationResponse(w, r, v.Errors())
+			return uuid.Nil, "", false
+		}
+
+		isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return uuid.Nil, "", false
+		}
+
+		if !isParticipant {
+			s.notFoundResponse(w, r)
+			return uuid.Nil, "", false
+		}
+
+		return *groupID, conversationType, true
+	}
+}
+
+// saveDraft handles PUT requests on the draft endpoints of all conversation types.
+func (s *APIServer) saveDraft(w http.ResponseWriter, r *http.Request, conversationType string) {
+	var input struct {
+		Content          string     `json:"content"`
+		Format           string     `json:"format"`
+		RepliedMessageID *uuid.UUID `json:"replied_message_id"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	conversationID, conversationType, ok := s.participantConversationFromRequest(w, r, conversationType)
+	if !ok {
+		return
+	}
+
+	draft := &data.ConversationDraft{
+		UserID:           s.contextGetUser(r).ID,
+		ConversationID:   conversationID,
+		Content:          input.Content,
+		Format:           input.Format,
+		RepliedMessageID: input.RepliedMessageID,
+	}
+
+	if draft.Format == "" {
+		draft.Format = data.FormatPlain
+	}
+
+	v := validator.New()
+
+	data.ValidateConversationDraft(v, draft)
+
+	// Check replied message exists
+	if input.RepliedMessageID != nil {
+		msgExists, err := s.models.ConversationMessage.BelongsToConversation(r.Context(), *input.RepliedMessageID, conversationID, conversationType)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return
+		}
+
+		v.Check(msgExists, "replied_message_id", "does not exist")
+	}
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if err := s.models.ConversationDraft.Upsert(r.Context(), draft); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"draft": draft}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// deleteDraft handles DELETE requests on the draft endpoints of all conversation types.
+func (s *APIServer) deleteDraft(w http.ResponseWriter, r *http.Request, conversationType string) {
+	conversationID, _, ok := s.participantConversationFromRequest(w, r, conversationType)
+	if !ok {
+		return
+	}
+
+	if err := s.models.ConversationDraft.Delete(r.Context(), s.contextGetUser(r).ID, conversationID); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSavePrivateDraft handles the PUT /conversations/private/:other_user_id/draft endpoint.
+func (s *APIServer) handleSavePrivateDraft(w http.ResponseWriter, r *http.Request) {
+	s.saveDraft(w, r, data.ConversationTypePrivate)
+}
+
+// handleDeletePrivateDraft handles the DELETE /conversations/private/:other_user_id/draft endpoint.
+func (s *APIServer) handleDeletePrivateDraft(w http.ResponseWriter, r *http.Request) {
+	s.deleteDraft(w, r, data.ConversationTypePrivate)
+}
+
+// handleSaveGroupDraft handles the PUT /conversations/group/:group_id/draft endpoint.
+func (s *APIServer) handleSaveGroupDraft(w http.ResponseWriter, r *http.Request) {
+	s.saveDraft(w, r, data.ConversationTypeGroup)
+}
+
+// handleDeleteGroupDraft handles the DELETE /conversations/group/:group_id/draft endpoint.
+func (s *APIServer) handleDeleteGroupDraft(w http.ResponseWriter, r *http.Request) {
+	s.deleteDraft(w, r, data.ConversationTypeGroup)
+}
+
+// handleSaveSelfDraft handles the PUT /conversations/self/draft endpoint.
+func (s *APIServer) handleSaveSelfDraft(w http.ResponseWriter, r *http.Request) {
+	s.saveDraft(w, r, data.ConversationTypeSelf)
+}
+
+// handleDeleteSelfDraft handles the DELETE /conversations/self/draft endpoint.
+func (s *APIServer) handleDeleteSelfDraft(w http.ResponseWriter, r *http.Request) {
+	s.deleteDraft(w, r, data.ConversationTypeSelf)
+}
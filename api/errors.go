@@ -83,3 +83,18 @@ func (s *APIServer) permissionDeniedResponse(w http.ResponseWriter, r *http.Requ
 	message := "access forbidden"
 	s.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (s *APIServer) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "idempotency key has already been used for a different request"
+	s.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (s *APIServer) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same idempotency key is still being processed"
+	s.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (s *APIServer) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the If-Match header must be set to the ETag of the resource"
+	s.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// folderFromRequest returns the folder of the current user the request refers to.
+// If false is returned, a response has already been written.
+func (s *APIServer) folderFromRequest(w http.ResponseWriter, r *http.Request) (*data.ConversationFolder, bool) {
+	v := validator.New()
+
+	folderID := s.readUUIDParam("folder_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return nil, false
+	}
+
+	folder, err := s.models.ConversationFolder.Get(r.Context(), *folderID, s.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return folder, true
+}
+
+// handleListFolders handles the GET /users/me/folders endpoint.
+func (s *APIServer) handleListFolders(w http.ResponseWriter, r *http.Request) {
+	folders, err := s.models.ConversationFolder.GetAllForUser(r.Context(), s.contextGetUser(r).ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"folders": folders}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleCreateFolder handles the POST /users/me/folders endpoint.
+// The folder is placed after the other folders of the user.
+func (s *APIServer) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name          string   `json:"name"`
+		IncludeTypes  []string `json:"include_types"`
+		IncludeUnread bool     `json:"include_unread"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	folder := &data.ConversationFolder{
+		UserID:        user.ID,
+		Name:          input.Name,
+		IncludeTypes:  input.IncludeTypes,
+		IncludeUnread: input.IncludeUnread,
+	}
+
+	if folder.IncludeTypes == nil {
+		folder.IncludeTypes = []string{}
+	}
+
+	v := validator.New()
+
+	if data.ValidateConversationFolder(v, folder); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.Insert(r.Context(), folder)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrFolderLimitReached):
+			v.AddError("name", fmt.Sprintf("must not exceed %d folders", data.MaxConversationFolders))
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"folder": folder}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleUpdateFolder handles the PATCH /users/me/folders/:folder_id endpoint.
+func (s *APIServer) handleUpdateFolder(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name          *string   `json:"name"`
+		IncludeTypes  *[]string `json:"include_types"`
+		IncludeUnread *bool     `json:"include_unread"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	folder, ok := s.folderFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		folder.Name = *input.Name
+	}
+
+	if input.IncludeTypes != nil {
+		folder.IncludeTypes = *input.IncludeTypes
+
+		if folder.IncludeTypes == nil {
+			folder.IncludeTypes = []string{}
+		}
+	}
+
+	if input.IncludeUnread != nil {
+		folder.IncludeUnread = *input.IncludeUnread
+	}
+
+	v := validator.New()
+
+	if data.ValidateConversationFolder(v, folder); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.Update(r.Context(), folder)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			s.editConflictResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleDeleteFolder handles the DELETE /users/me/folders/:folder_id endpoint.
+// The conversations in the folder are left as they are.
+func (s *APIServer) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	folderID := s.readUUIDParam("folder_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.Delete(r.Context(), *folderID, s.contextGetUser(r).ID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReorderFolders handles the PUT /users/me/folders/order endpoint.
+// It takes the ids of all folders of the user in their new order.
+func (s *APIServer) handleReorderFolders(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FolderIDs []uuid.UUID `json:"folder_ids"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	folders, err := s.models.ConversationFolder.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	folderIDs := make([]uuid.UUID, 0, len(folders))
+
+	for _, folder := range folders {
+		folderIDs = append(folderIDs, folder.ID)
+	}
+
+	v := validator.New()
+
+	sortedInput := slices.Clone(input.FolderIDs)
+	slices.SortFunc(sortedInput, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	slices.SortFunc(folderIDs, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+
+	if v.Check(slices.Equal(sortedInput, folderIDs), "folder_ids", "must contain the ids of all folders exactly once"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.Reorder(r.Context(), user.ID, input.FolderIDs)
+	})
+
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	folders, err = s.models.ConversationFolder.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"folders": folders}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleAddFolderConversation handles the POST /users/me/folders/:folder_id/conversations endpoint.
+// Conversations can be added to folders regardless of their rules, and are removed from them when the user leaves.
+func (s *APIServer) handleAddFolderConversation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ConversationID uuid.UUID `json:"conversation_id"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	folder, ok := s.folderFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.AddConversation(r.Context(), folder, input.ConversationID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConversationDoesNotExist):
+			v := validator.New()
+			v.AddError("conversation_id", "does not exist")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleRemoveFolderConversation handles the DELETE /users/me/folders/:folder_id/conversations/:conversation_id endpoint.
+func (s *APIServer) handleRemoveFolderConversation(w http.ResponseWriter, r *http.Request) {
+	folder, ok := s.folderFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	conversationID := s.readUUIDParam("conversation_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationFolder.RemoveConversation(r.Context(), folder, *conversationID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,898 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// errPermissionDenied is returned from transactions aborted because the user is not allowed to make the change.
+var errPermissionDenied = errors.New("permission denied")
+
+// errUnexpectedRole is returned from transactions changing the role of a participant who doesn't have the expected role.
+var errUnexpectedRole = errors.New("unexpected role")
+
+// authorizeGroup returns the role of the user in the group if the role grants the permission.
+// Otherwise it writes the response: not found if the user is not a participant of the group,
+// so non-participants can't tell whether it exists, and permission denied if the role lacks the permission.
+func (s *APIServer) authorizeGroup(w http.ResponseWriter, r *http.Request, groupID, userID uuid.UUID, permission data.Permission) (string, bool) {
+	return s.authorizeParticipant(w, r, data.ConversationTypeGroup, groupID, userID, permission)
+}
+
+// authorizeParticipant is authorizeGroup for conversations of any type with roles, i.e. groups and channels.
+func (s *APIServer) authorizeParticipant(w http.ResponseWriter, r *http.Request, conversationType string, conversationID, userID uuid.UUID, permission data.Permission) (string, bool) {
+	role, err := s.models.ConversationParticipant.GetRole(r.Context(), userID, conversationID, conversationType)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return "", false
+	}
+
+	if !data.RoleHasPermission(role, permission) {
+		s.permissionDeniedResponse(w, r)
+		return "", false
+	}
+
+	return role, true
+}
+
+// handlePromoteGroupParticipant handles the POST /conversations/group/:group_id/participants/:user_id/promote endpoint.
+// It makes a member of the group an admin.
+func (s *APIServer) handlePromoteGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.changeParticipantRole(w, r, data.ConversationTypeGroup, data.RoleMember, data.RoleAdmin)
+}
+
+// handleDemoteGroupParticipant handles the POST /conversations/group/:group_id/participants/:user_id/demote endpoint.
+// It makes an admin of the group a regular member.
+func (s *APIServer) handleDemoteGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.changeParticipantRole(w, r, data.ConversationTypeGroup, data.RoleAdmin, data.RoleMember)
+}
+
+// changeParticipantRole changes the role of a participant of a group or channel from one role to another.
+// The owner's role can only change by transferring ownership.
+func (s *APIServer) changeParticipantRole(w http.ResponseWriter, r *http.Request, conversationType, from, to string) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	// Conversations are identified by the group_id or channel_id parameter.
+	conversationID := s.readUUIDParam(conversationType+"_id", r, v)
+	participantID := s.readUUIDParam("user_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeParticipant(w, r, conversationType, *conversationID, user.ID, data.PermissionManageAdmins); !ok {
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *conversationID); err != nil {
+			return err
+		}
+
+		// Both roles are checked again in the transaction in case ownership or roles changed concurrently.
+		role, err := tx.ConversationParticipant.GetRole(r.Context(), user.ID, *conversationID, conversationType)
+		if err != nil {
+			return err
+		}
+
+		if !data.RoleHasPermission(role, data.PermissionManageAdmins) {
+			return errPermissionDenied
+		}
+
+		participantRole, err := tx.ConversationParticipant.GetRole(r.Context(), *participantID, *conversationID, conversationType)
+		if err != nil {
+			return err
+		}
+
+		if participantRole != from {
+			return errUnexpectedRole
+		}
+
+		return tx.ConversationParticipant.UpdateRole(r.Context(), *conversationID, *participantID, to)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		case errors.Is(err, errUnexpectedRole):
+			v.AddError("user_id", "must be a participant with the "+from+" role")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRemoveGroupParticipant handles the DELETE /conversations/group/:group_id/participants/:user_id endpoint.
+// Owners and admins can remove participants with a lower role than theirs.
+func (s *APIServer) handleRemoveGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	participantID := s.readUUIDParam("user_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	role, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionRemoveMembers)
+	if !ok {
+		return
+	}
+
+	if v.Check(*participantID != user.ID, "user_id", "must not be the current user, leave the group instead"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		participantRole, err := tx.ConversationParticipant.GetRole(r.Context(), *participantID, *groupID, data.ConversationTypeGroup)
+		if err != nil {
+			return err
+		}
+
+		if !data.RoleOutranks(role, participantRole) {
+			return errPermissionDenied
+		}
+
+		if err := tx.ConversationParticipant.RemoveParticipant(r.Context(), *groupID, *participantID); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventParticipantRemoved, participantID))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLeaveGroup handles the POST /conversations/group/:group_id/leave endpoint.
+// When the owner leaves, ownership passes to the longest-standing admin, or member if there are no admins.
+// The group is deleted when its last participant leaves.
+func (s *APIServer) handleLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		role, err := tx.ConversationParticipant.GetRole(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+		if err != nil {
+			return err
+		}
+
+		if role == data.RoleOwner {
+			successorID, err := tx.ConversationParticipant.GetSuccessor(r.Context(), *groupID, user.ID)
+
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				// The participant is removed first so the change is synced to them before the group is gone.
+				if err := tx.ConversationParticipant.RemoveParticipant(r.Context(), *groupID, user.ID); err != nil {
+					return err
+				}
+
+				return tx.Conversation.Delete(r.Context(), *groupID)
+			case err != nil:
+				return err
+			}
+
+			if err := tx.Conversation.TransferGroupOwnership(r.Context(), *groupID, successorID); err != nil {
+				return err
+			}
+
+			err = tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventOwnershipTransferred, &successorID))
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.ConversationParticipant.RemoveParticipant(r.Context(), *groupID, user.ID); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventParticipantLeft, nil))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListGroupParticipants handles the GET /conversations/group/:group_id/participants endpoint.
+// It lists the participants of a group along with their roles, and is only available to participants.
+func (s *APIServer) handleListGroupParticipants(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !isParticipant {
+		s.notFoundResponse(w, r)
+		return
+	}
+
+	search := s.readStringQuery(r.URL.Query(), "search", "")
+
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 20, v),
+		Sort:         s.readStringQuery(r.URL.Query(), "sort", "role"),
+		SortSafeList: []string{"role", "-role", "username", "-username", "joined_at", "-joined_at"},
+	}
+
+	v.Check(len(search) <= 100, "search", "must not be more than 100 bytes long")
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	participants, paginationMetadata, err := s.models.ConversationParticipant.GetAllForGroup(r.Context(), *groupID, search, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"participants": participants, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleUpdateGroup handles the PATCH /conversations/group/:group_id endpoint.
+// It changes the name, description, avatar or visibility of a group, recording each change as a system message.
+// The If-Match header must hold the ETag of the group as the client last read it; if it changed since, the edit conflicts.
+// Only the owner can change the visibility.
+// An empty description or avatar url removes it.
+func (s *APIServer) handleUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		AvatarURL   *string `json:"avatar_url"`
+		Visibility  *string `json:"visibility"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	role, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionEditGroupInfo)
+	if !ok {
+		return
+	}
+
+	version, ok := s.readIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The group must not have changed since the client read the version it edited.
+	if group.Version != version {
+		s.editConflictResponse(w, r)
+		return
+	}
+
+	metadata := group.GroupMetadata
+	events := make([]string, 0, 4)
+
+	if input.Name != nil && *input.Name != metadata.Name {
+		metadata.Name = *input.Name
+		events = append(events, data.EventGroupRenamed)
+	}
+
+	if input.Description != nil && *input.Description != stringValue(metadata.Description) {
+		metadata.Description = nilIfEmpty(*input.Description)
+		events = append(events, data.EventDescriptionChanged)
+	}
+
+	if input.AvatarURL != nil && *input.AvatarURL != stringValue(metadata.AvatarURL) {
+		metadata.AvatarURL = nilIfEmpty(*input.AvatarURL)
+		events = append(events, data.EventAvatarChanged)
+	}
+
+	if input.Visibility != nil && *input.Visibility != metadata.Visibility {
+		if !data.RoleHasPermission(role, data.PermissionChangeVisibility) {
+			s.permissionDeniedResponse(w, r)
+			return
+		}
+
+		metadata.Visibility = *input.Visibility
+		events = append(events, data.EventVisibilityChanged)
+	}
+
+	if data.ValidateGroupMetadata(v, *metadata); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if len(events) > 0 {
+		err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+			if err := tx.Conversation.Lock(r.Context(), group.ID); err != nil {
+				return err
+			}
+
+			if err := tx.Conversation.UpdateGroupMetadata(r.Context(), group); err != nil {
+				return err
+			}
+
+			for _, event := range events {
+				if err := tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(group.ID, user.ID, event, nil)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				s.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrEditConflict):
+				s.editConflictResponse(w, r)
+			default:
+				s.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group}, groupETag(group)); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// groupETag returns the ETag header of the group's current version, which clients send back in If-Match when updating it.
+func groupETag(group *data.Conversation) http.Header {
+	return http.Header{"ETag": []string{strconv.Quote(strconv.FormatInt(group.Version, 10))}}
+}
+
+// readIfMatch returns the version in the If-Match header, which must hold an ETag from groupETag.
+// If false is returned, a response has already been written.
+func (s *APIServer) readIfMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		s.preconditionRequiredResponse(w, r)
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil {
+		v := validator.New()
+		v.AddError("If-Match", "must be an ETag of the resource")
+		s.failedValidationResponse(w, r, v.Errors())
+		return 0, false
+	}
+
+	return version, true
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// handleTransferGroupOwnership handles the POST /conversations/group/:group_id/transfer-ownership endpoint.
+// The owner hands the group over to another participant and becomes an admin.
+// Unless disabled in the config, the owner has to confirm it with their password.
+func (s *APIServer) handleTransferGroupOwnership(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID   uuid.UUID `json:"user_id"`
+		Password string    `json:"password"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionTransferOwnership); !ok {
+		return
+	}
+
+	v.Check(input.UserID != uuid.Nil, "user_id", "must be provided")
+	v.Check(input.UserID != user.ID, "user_id", "must not be the current owner")
+
+	if s.config.Groups.OwnershipTransferRequiresPassword {
+		v.Check(input.Password != "", "password", "must be provided")
+	}
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if s.config.Groups.OwnershipTransferRequiresPassword {
+		match, err := user.Password.Matches(input.Password)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if v.Check(match, "password", "is incorrect"); !v.Valid() {
+			s.failedValidationResponse(w, r, v.Errors())
+			return
+		}
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		// The role is checked again in the transaction in case ownership changed concurrently.
+		role, err := tx.ConversationParticipant.GetRole(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+		if err != nil {
+			return err
+		}
+
+		if role != data.RoleOwner {
+			return errPermissionDenied
+		}
+
+		if err := tx.Conversation.TransferGroupOwnership(r.Context(), *groupID, input.UserID); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventOwnershipTransferred, &input.UserID))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("user_id", "must be a participant of the group")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group}, groupETag(group)); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleDiscoverGroups handles the GET /groups/discover endpoint.
+// It lists public groups, optionally searching them by name.
+func (s *APIServer) handleDiscoverGroups(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	search := s.readStringQuery(r.URL.Query(), "search", "")
+
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 20, v),
+		Sort:         s.readStringQuery(r.URL.Query(), "sort", "-member_count"),
+		SortSafeList: []string{"member_count", "-member_count", "name", "-name", "created_at", "-created_at"},
+	}
+
+	v.Check(len(search) <= 100, "search", "must not be more than 100 bytes long")
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	groups, paginationMetadata, err := s.models.Conversation.GetAllPublicGroups(r.Context(), search, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"groups": groups, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// publicGroupFromRequest returns the group in the url if it's public or the user participates in it.
+// Otherwise a not found response is written, so private groups can't be told apart from missing ones.
+func (s *APIServer) publicGroupFromRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*data.Conversation, bool) {
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return nil, false
+	}
+
+	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if group.GroupMetadata.Visibility == data.GroupVisibilityPublic {
+		return group, true
+	}
+
+	isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), userID, group.ID, data.ConversationTypeGroup)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !isParticipant {
+		s.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return group, true
+}
+
+// handlePreviewGroup handles the GET /conversations/group/:group_id/preview endpoint.
+// It lets any user read the recent history of a public group before joining it.
+// Unlike handleListGroupMessages it's available to non-participants, so senders' emails are left out.
+func (s *APIServer) handlePreviewGroup(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	group, ok := s.publicGroupFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	f := filter.Filters{
+		Page:         1,
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 20, v),
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+
+	v.Check(f.PageSize <= 50, "page_size", "must be a maximum of 50")
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	messages, _, err := s.models.ConversationMessage.GetAllForGroup(r.Context(), group.ID, user.ID, f)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, m := range messages {
+		if m.Sender != nil {
+			m.Sender.Email = ""
+		}
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group, "messages": messages}, groupETag(group)); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleJoinPublicGroup handles the POST /conversations/group/:group_id/join endpoint.
+// Any user can join a public group directly, without an invite.
+func (s *APIServer) handleJoinPublicGroup(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	group, ok := s.publicGroupFromRequest(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	// Participants of private groups get here too, but they can't have joined it this way.
+	if group.GroupMetadata.Visibility != data.GroupVisibilityPublic {
+		v.AddError("group_id", "already a participant")
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	// The group is locked so a concurrent ban can't miss the joining user, and vice versa.
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), group.ID); err != nil {
+			return err
+		}
+
+		if err := tx.ConversationParticipant.AddParticipant(r.Context(), &group.ID, &user.ID, s.config.Groups.MaxMembers); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(group.ID, user.ID, data.EventParticipantJoined, nil))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConversationParticipantDuplicate):
+			v.AddError("group_id", "already a participant")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrGroupFull):
+			v.AddError("group_id", "is full")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrNoRecordFound), errors.Is(err, data.ErrConversationDoesNotExist):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrConversationParticipantBanned):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	group.GroupMetadata.MemberCount++
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group}, groupETag(group)); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleGetGroupSettings handles the GET /conversations/group/:group_id/settings endpoint.
+func (s *APIServer) handleGetGroupSettings(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !isParticipant {
+		s.notFoundResponse(w, r)
+		return
+	}
+
+	settings, err := s.models.Conversation.GetGroupSettings(r.Context(), *groupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleUpdateGroupSettings handles the PATCH /conversations/group/:group_id/settings endpoint.
+// It changes who can send messages, send media and add members, and the slow mode interval.
+func (s *APIServer) handleUpdateGroupSettings(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SendMessages     *string `json:"send_messages"`
+		SendMedia        *string `json:"send_media"`
+		AddMembers       *string `json:"add_members"`
+		SlowModeInterval *int    `json:"slow_mode_interval"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionChangeSettings); !ok {
+		return
+	}
+
+	group, err := s.models.Conversation.Get(r.Context(), *groupID, data.ConversationTypeGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	settings, err := s.models.Conversation.GetGroupSettings(r.Context(), group.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	previous := *settings
+
+	if input.SendMessages != nil {
+		settings.SendMessages = *input.SendMessages
+	}
+
+	if input.SendMedia != nil {
+		settings.SendMedia = *input.SendMedia
+	}
+
+	if input.AddMembers != nil {
+		settings.AddMembers = *input.AddMembers
+	}
+
+	if input.SlowModeInterval != nil {
+		settings.SlowModeInterval = *input.SlowModeInterval
+	}
+
+	if data.ValidateGroupSettings(v, settings); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if *settings != previous {
+		err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+			if err := tx.Conversation.Lock(r.Context(), group.ID); err != nil {
+				return err
+			}
+
+			if err := tx.Conversation.UpdateGroupSettings(r.Context(), group, settings); err != nil {
+				return err
+			}
+
+			return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(group.ID, user.ID, data.EventSettingsChanged, nil))
+		})
+
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				s.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrEditConflict):
+				s.editConflictResponse(w, r)
+			default:
+				s.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
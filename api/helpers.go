@@ -16,6 +16,9 @@ import (
 	"github.com/thisisjab/gchat-go/internal/validator"
 )
 
+// maxRequestBodyBytes is the maximum size of request bodies read by the server.
+const maxRequestBodyBytes = 1_048_576
+
 // envelope is used when returning JSON responses. Any JSON object must be enveloped.
 type envelope map[string]any
 
@@ -41,9 +44,7 @@ func (s *APIServer) writeJSON(w http.ResponseWriter, status int, data envelope,
 // readJSON is used when reading JSON requests. It reads the request body into the destination.
 // If any expected error occurs, it is returned and can be handled as a bad request.
 func (s *APIServer) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
-	const maxBytes = 1_048_576
-
-	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 	err := dec.Decode(dst)
@@ -77,7 +78,7 @@ func (s *APIServer) readJSON(w http.ResponseWriter, r *http.Request, dst any) er
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			return fmt.Errorf("body must not be larger than %d bytes", maxRequestBodyBytes)
 
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
@@ -96,6 +97,17 @@ func (s *APIServer) readJSON(w http.ResponseWriter, r *http.Request, dst any) er
 	return nil
 }
 
+// readStringQuery reads a string value from the query string.
+func (s *APIServer) readStringQuery(qs url.Values, key string, defaultValue string) string {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
 // readIntQuery reads an integer value from the query string.
 func (s *APIServer) readIntQuery(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	value := qs.Get(key)
@@ -113,6 +125,23 @@ func (s *APIServer) readIntQuery(qs url.Values, key string, defaultValue int, v
 	return i
 }
 
+// readBoolQuery reads a boolean value from the query string.
+func (s *APIServer) readBoolQuery(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be a boolean")
+		return defaultValue
+	}
+
+	return b
+}
+
 // readUUIDParam reads a UUID value from the query string.
 func (s *APIServer) readUUIDParam(key string, r *http.Request, v *validator.Validator) *uuid.UUID {
 	params := httprouter.ParamsFromContext(r.Context())
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// handleCreateGroupInvite handles the POST /conversations/group/:group_id/invites endpoint.
+// Owners and admins can create invite links, optionally expiring, limited in uses or requiring approval to join.
+// The code is only returned in this response since only its hash is stored.
+func (s *APIServer) handleCreateGroupInvite(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ExpiresAt        *time.Time `json:"expires_at"`
+		MaxUses          *int       `json:"max_uses"`
+		RequiresApproval bool       `json:"requires_approval"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionAddMembers); !ok {
+		return
+	}
+
+	invite := &data.GroupInvite{
+		ConversationID:   *groupID,
+		CreatedBy:        user.ID,
+		ExpiresAt:        input.ExpiresAt,
+		MaxUses:          input.MaxUses,
+		RequiresApproval: input.RequiresApproval,
+	}
+
+	if data.ValidateGroupInvite(v, invite); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if err := s.models.GroupInvite.Insert(r.Context(), invite); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"invite": invite}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleListGroupInvites handles the GET /conversations/group/:group_id/invites endpoint.
+// It lists the invites of a group which have not been revoked, and is only available to the owner.
+func (s *APIServer) handleListGroupInvites(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionManageInvites); !ok {
+		return
+	}
+
+	invites, err := s.models.GroupInvite.GetAllForGroup(r.Context(), *groupID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"invites": invites}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleRevokeGroupInvite handles the DELETE /conversations/group/:group_id/invites/:invite_id endpoint.
+func (s *APIServer) handleRevokeGroupInvite(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	inviteID := s.readUUIDParam("invite_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionManageInvites); !ok {
+		return
+	}
+
+	if err := s.models.GroupInvite.Revoke(r.Context(), *groupID, *inviteID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inviteFromRequest returns the usable invite whose code is in the url along with its group.
+// If the code is invalid or the invite can't be used, the response is written and ok is false.
+func (s *APIServer) inviteFromRequest(w http.ResponseWriter, r *http.Request) (*data.GroupInvite, *data.Conversation, bool) {
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	v := validator.New()
+
+	if data.ValidateInviteCode(v, code); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return nil, nil, false
+	}
+
+	invite, err := s.models.GroupInvite.GetByCode(r.Context(), code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	group, err := s.models.Conversation.Get(r.Context(), invite.ConversationID, data.ConversationTypeGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return invite, group, true
+}
+
+// handlePreviewGroupInvite handles the GET /invites/:code endpoint.
+// It shows the group an invite is for, so users can decide whether to join it.
+func (s *APIServer) handlePreviewGroupInvite(w http.ResponseWriter, r *http.Request) {
+	invite, group, ok := s.inviteFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	preview := envelope{
+		"group": group,
+		"invite": envelope{
+			"expires_at":        invite.ExpiresAt,
+			"requires_approval": invite.RequiresApproval,
+		},
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, preview, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleJoinGroupWithInvite handles the POST /invites/:code/join endpoint.
+// It adds the current user to the group of the invite, using up one of its uses.
+func (s *APIServer) handleJoinGroupWithInvite(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	invite, group, ok := s.inviteFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(!invite.RequiresApproval, "code", "requires approval, submit a join request instead"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	// The group is locked so a concurrent ban can't miss the joining user, and vice versa.
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), group.ID); err != nil {
+			return err
+		}
+
+		if err := tx.ConversationParticipant.AddParticipant(r.Context(), &group.ID, &user.ID, s.config.Groups.MaxMembers); err != nil {
+			return err
+		}
+
+		if err := tx.GroupInvite.Use(r.Context(), invite.ID); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(group.ID, user.ID, data.EventParticipantJoined, nil))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConversationParticipantDuplicate):
+			v.AddError("code", "already a participant")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrGroupFull):
+			v.AddError("code", "the group is full")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrNoRecordFound), errors.Is(err, data.ErrConversationDoesNotExist):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrConversationParticipantBanned):
+			s.permissionDeniedResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	group.GroupMetadata.MemberCount++
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"group": group}, groupETag(group)); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// handleCreateJoinRequest handles the POST /invites/:code/requests endpoint.
+// It asks to join the group of an invite requiring approval, optionally with a message for its admins.
+// Users can only submit a limited number of requests per hour.
+// The request doesn't use up the invite; it's only counted as a use once the request is approved.
+func (s *APIServer) handleCreateJoinRequest(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Message *string `json:"message"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	invite, group, ok := s.inviteFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(invite.RequiresApproval, "code", "does not require approval, join directly instead"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	request := &data.GroupJoinRequest{
+		ConversationID: group.ID,
+		UserID:         user.ID,
+		InviteID:       &invite.ID,
+		Message:        input.Message,
+	}
+
+	if data.ValidateGroupJoinRequest(v, request); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	isParticipant, err := s.models.ConversationParticipant.Exists(r.Context(), user.ID, group.ID, data.ConversationTypeGroup)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.Check(!isParticipant, "code", "already a participant"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	banned, err := s.models.GroupRestriction.IsRestricted(r.Context(), group.ID, user.ID, data.RestrictionBan)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if banned {
+		s.permissionDeniedResponse(w, r)
+		return
+	}
+
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.GroupJoinRequest.Insert(r.Context(), request, s.config.Groups.JoinRequestTTL, s.config.Groups.JoinRequestsPerHour)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrJoinRequestDuplicate):
+			v.AddError("code", "already requested to join")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrJoinRequestLimitReached):
+			s.rateLimitExceededResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"join_request": request}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleListJoinRequests handles the GET /conversations/group/:group_id/requests endpoint.
+// It lists the pending join requests of a group to its owner and admins.
+func (s *APIServer) handleListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionAddMembers); !ok {
+		return
+	}
+
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 20, v),
+		Sort:         s.readStringQuery(r.URL.Query(), "sort", "created_at"),
+		SortSafeList: []string{"created_at", "-created_at"},
+	}
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	requests, paginationMetadata, err := s.models.GroupJoinRequest.GetAllPendingForGroup(r.Context(), *groupID, s.config.Groups.JoinRequestTTL, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"join_requests": requests, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleApproveJoinRequest handles the POST /conversations/group/:group_id/requests/:request_id/approve endpoint.
+// It adds the user who requested to join to the group.
+func (s *APIServer) handleApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	s.decideJoinRequest(w, r, data.JoinRequestApproved)
+}
+
+// handleRejectJoinRequest handles the POST /conversations/group/:group_id/requests/:request_id/reject endpoint.
+func (s *APIServer) handleRejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	s.decideJoinRequest(w, r, data.JoinRequestRejected)
+}
+
+// errInviteUsedUp is returned from transactions approving a join request whose invite can't be used anymore.
+var errInviteUsedUp = errors.New("invite used up")
+
+// decideJoinRequest approves or rejects a pending join request, depending on status.
+// Approving it counts a use of the invite it was submitted with.
+func (s *APIServer) decideJoinRequest(w http.ResponseWriter, r *http.Request, status string) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	requestID := s.readUUIDParam("request_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionAddMembers); !ok {
+		return
+	}
+
+	request := &data.GroupJoinRequest{ID: *requestID, ConversationID: *groupID}
+
+	// The group is locked so a concurrent ban can't miss the approved user, and vice versa.
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		if err := tx.GroupJoinRequest.Decide(r.Context(), request, status, user.ID, s.config.Groups.JoinRequestTTL); err != nil {
+			return err
+		}
+
+		if status != data.JoinRequestApproved {
+			return nil
+		}
+
+		err := tx.ConversationParticipant.AddParticipant(r.Context(), groupID, &request.UserID, s.config.Groups.MaxMembers)
+
+		switch {
+		// The user may have joined in another way since requesting.
+		case errors.Is(err, data.ErrConversationParticipantDuplicate):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if request.InviteID != nil {
+			err := tx.GroupInvite.Use(r.Context(), *request.InviteID)
+
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				return errInviteUsedUp
+			case err != nil:
+				return err
+			}
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventParticipantAdded, &request.UserID))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrConversationParticipantBanned):
+			v.AddError("request_id", "the user is banned from the group")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrGroupFull):
+			v.AddError("request_id", "the group is full")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, errInviteUsedUp):
+			v.AddError("request_id", "the invite it was submitted with can't be used anymore")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"join_request": request}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
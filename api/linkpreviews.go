@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/markup"
+	"github.com/thisisjab/gchat-go/internal/unfurl"
+)
+
+// previewURL returns the url a link preview should be generated for, or an empty string.
+// Links of formatted messages take precedence over urls found in the text.
+func previewURL(msg *data.ConversationMessage) string {
+	if msg.Type != data.TypeTextMessage {
+		return ""
+	}
+
+	for _, entity := range msg.Entities {
+		if entity.Type == markup.EntityLink {
+			return entity.URL
+		}
+	}
+
+	if urls := unfurl.ExtractURLs(msg.Content); len(urls) > 0 {
+		return urls[0]
+	}
+
+	return ""
+}
+
+// unfurlMessage attaches a link preview to the message in the background.
+// Cached previews are reused; otherwise the page is fetched and cached.
+// Urls that failed to be fetched are not fetched again until the failure ttl passed.
+func (s *APIServer) unfurlMessage(msg *data.ConversationMessage) {
+	if !s.config.LinkPreviews.Enabled {
+		return
+	}
+
+	url := previewURL(msg)
+	if url == "" {
+		return
+	}
+
+	messageID := msg.ID
+
+	s.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*s.config.LinkPreviews.Timeout+5*time.Second)
+		defer cancel()
+
+		preview, err := s.models.LinkPreview.GetFresh(ctx, url, s.config.LinkPreviews.CacheTTL)
+		if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+			s.logger.Error("error reading link preview cache", "url", url, "error", err)
+			return
+		}
+
+		if preview == nil {
+			failed, err := s.models.LinkPreview.HasFailedRecently(ctx, url, s.config.LinkPreviews.FailureTTL)
+			if err != nil {
+				s.logger.Error("error reading link preview cache", "url", url, "error", err)
+				return
+			}
+
+			if failed {
+				return
+			}
+
+			metadata, err := s.unfurler.Fetch(ctx, url)
+			if err != nil {
+				s.logger.Debug("could not fetch link preview", "url", url, "error", err)
+
+				if err := s.models.LinkPreview.RecordFailure(ctx, url); err != nil {
+					s.logger.Error("error caching link preview failure", "url", url, "error", err)
+				}
+
+				return
+			}
+
+			preview = &data.LinkPreview{
+				URL:         url,
+				Title:       nilIfEmpty(metadata.Title),
+				Description: nilIfEmpty(metadata.Description),
+				ImageURL:    nilIfEmpty(metadata.ImageURL),
+				SiteName:    nilIfEmpty(metadata.SiteName),
+			}
+
+			if err := s.models.LinkPreview.Upsert(ctx, preview); err != nil {
+				s.logger.Error("error caching link preview", "url", url, "error", err)
+				return
+			}
+		}
+
+		err = s.models.Transaction(ctx, func(tx *data.Models) error {
+			return tx.LinkPreview.AttachToMessage(ctx, messageID, preview.URL)
+		})
+
+		if err != nil {
+			s.logger.Error("error attaching link preview", "message_id", messageID, "error", err)
+		}
+	})
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// handleUpdateLiveLocation handles the PATCH /messages/:message_id/location endpoint.
+// It lets the sender of a live location message update the coordinates until the location expires.
+func (s *APIServer) handleUpdateLiveLocation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Latitude  float64  `json:"latitude"`
+		Longitude float64  `json:"longitude"`
+		Accuracy  *float64 `json:"accuracy"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	messageID := s.readUUIDParam("message_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	msg, err := s.models.ConversationMessage.GetForParticipant(r.Context(), *messageID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if msg.Type != data.TypeLocationMessage {
+		s.notFoundResponse(w, r)
+		return
+	}
+
+	if msg.SenderID == nil || *msg.SenderID != user.ID {
+		s.permissionDeniedResponse(w, r)
+		return
+	}
+
+	if v.Check(msg.Location.IsLive(), "location", "is not live"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	msg.Location.Latitude = input.Latitude
+	msg.Location.Longitude = input.Longitude
+	msg.Location.Accuracy = input.Accuracy
+
+	// Live until is already known to be valid, so only the coordinates are checked.
+	data.ValidateLocation(v, &data.Location{Latitude: msg.Location.Latitude, Longitude: msg.Location.Longitude, Accuracy: msg.Location.Accuracy})
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationMessage.UpdatePayload(r.Context(), msg)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			s.editConflictResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"message": msg}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleStarMessage handles the POST /messages/:message_id/star endpoint.
+// It bookmarks a message of a conversation the current user participates in, with an optional note.
+func (s *APIServer) handleStarMessage(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Note *string `json:"note"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	messageID := s.readUUIDParam("message_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	msg, err := s.models.ConversationMessage.GetForParticipant(r.Context(), *messageID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	starred := &data.StarredMessage{
+		UserID:         user.ID,
+		ConversationID: msg.ConversationID,
+		Message:        msg,
+		Note:           input.Note,
+	}
+
+	if data.ValidateStarredMessage(v, starred); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if err := s.models.StarredMessage.Star(r.Context(), starred); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{"starred_message": starred}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleUnstarMessage handles the DELETE /messages/:message_id/star endpoint.
+func (s *APIServer) handleUnstarMessage(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	messageID := s.readUUIDParam("message_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if err := s.models.StarredMessage.Unstar(r.Context(), user.ID, *messageID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListStarredMessages handles the GET /users/me/starred endpoint.
+// It lists the messages starred by the current user in conversations they still participate in.
+func (s *APIServer) handleListStarredMessages(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+	f := filter.Filters{
+		Page:         s.readIntQuery(r.URL.Query(), "page", 1, v),
+		PageSize:     s.readIntQuery(r.URL.Query(), "page_size", 10, v),
+		Sort:         s.readStringQuery(r.URL.Query(), "sort", "-starred_at"),
+		SortSafeList: []string{"starred_at", "-starred_at"},
+	}
+
+	if filter.ValidateFilters(v, f); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	starred, paginationMetadata, err := s.models.StarredMessage.GetAllForUser(r.Context(), user.ID, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, filter.InvalidPageError):
+			s.badRequestResponse(w, r, err)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"starred_messages": starred, "pagination": paginationMetadata}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
 	"golang.org/x/time/rate"
 )
 
@@ -108,7 +115,7 @@ func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
 					// Handle preflight requests.
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
 						w.WriteHeader(http.StatusOK)
 
 						return
@@ -121,3 +128,170 @@ func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// responseRecorder captures the status code and body written by a handler while passing them through.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	rr.statusCode = statusCode
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+const (
+	// idempotencyKeyTTL is how long responses are kept for retries.
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyPurgeInterval is how often expired keys are purged, in batches of idempotencyKeyPurgeBatchSize.
+	idempotencyKeyPurgeInterval  = time.Hour
+	idempotencyKeyPurgeBatchSize = 1000
+)
+
+// idempotent makes a POST handler safe to retry for clients sending an Idempotency-Key header.
+// The first successful response is stored per user and key; retries of the same request replay it with a 200
+// instead of running the handler again. Failed requests release the key so they can be retried.
+// It must be wrapped by requireAuthenticatedUser (or requireActivatedUser).
+func (s *APIServer) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyValue := r.Header.Get("Idempotency-Key")
+		if keyValue == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateIdempotencyKey(v, keyValue); !v.Valid() {
+			s.failedValidationResponse(w, r, v.Errors())
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		if err != nil {
+			s.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxRequestBodyBytes))
+			return
+		}
+
+		// The handler reads the body again.
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+
+		key := &data.IdempotencyKey{
+			UserID:      s.contextGetUser(r).ID,
+			Key:         keyValue,
+			RequestHash: hash[:],
+		}
+
+		reserved, err := s.models.IdempotencyKey.Reserve(r.Context(), key, idempotencyKeyTTL)
+		if err != nil {
+			s.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !reserved {
+			s.replayIdempotentResponse(w, r, key)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		completed := false
+
+		// Release the key if the handler fails or panics so the request can be retried.
+		defer func() {
+			if !completed {
+				if err := s.models.IdempotencyKey.Release(r.Context(), key.UserID, key.Key); err != nil {
+					s.logError(r, err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		if rec.statusCode < 200 || rec.statusCode > 299 {
+			return
+		}
+
+		key.StatusCode = &rec.statusCode
+		key.ResponseBody = rec.body.Bytes()
+
+		if err := s.models.IdempotencyKey.Complete(r.Context(), key); err != nil {
+			s.logError(r, err)
+			return
+		}
+
+		completed = true
+	})
+}
+
+// replayIdempotentResponse writes the stored response of an idempotency key that's already taken.
+func (s *APIServer) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, key *data.IdempotencyKey) {
+	existing, err := s.models.IdempotencyKey.Get(r.Context(), key.UserID, key.Key)
+	if err != nil {
+		switch {
+		// The original request has just failed and released the key.
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.idempotencyKeyInProgressResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !bytes.Equal(existing.RequestHash, key.RequestHash) {
+		s.idempotencyKeyMismatchResponse(w, r)
+		return
+	}
+
+	if !existing.IsCompleted() {
+		s.idempotencyKeyInProgressResponse(w, r)
+		return
+	}
+
+	// Nothing is created by a replay, so 201 becomes 200.
+	statusCode := *existing.StatusCode
+	if statusCode == http.StatusCreated {
+		statusCode = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(statusCode)
+	w.Write(existing.ResponseBody)
+}
+
+// purgeExpiredIdempotencyKeys deletes expired idempotency keys in the background, every purge interval until stop is closed.
+// Expired keys are also reclaimed when they are reused, but most keys never are.
+func (s *APIServer) purgeExpiredIdempotencyKeys(stop <-chan struct{}) {
+	s.background(func() {
+		ticker := time.NewTicker(idempotencyKeyPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				deleted, err := s.models.IdempotencyKey.DeleteExpired(context.Background(), idempotencyKeyTTL, idempotencyKeyPurgeBatchSize)
+				if err != nil {
+					s.logger.Error(fmt.Sprintf("error while purging idempotency keys: %v", err))
+					break
+				}
+
+				if deleted < idempotencyKeyPurgeBatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
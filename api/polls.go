@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// pollFromRequest reads the `message_id` param and returns the message and its poll.
+// Only participants of the message's conversation can access the poll; everyone else gets a 404.
+// If false is returned, a response has already been written.
+func (s *APIServer) pollFromRequest(w http.ResponseWriter, r *http.Request) (*data.ConversationMessage, *data.Poll, bool) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	messageID := s.readUUIDParam("message_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return nil, nil, false
+	}
+
+	msg, err := s.models.ConversationMessage.GetForParticipant(r.Context(), *messageID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	poll, err := s.models.MessagePoll.Get(r.Context(), msg.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return msg, poll, true
+}
+
+// handleVotePoll handles the POST /messages/:message_id/poll/votes endpoint.
+// It replaces any previous vote of the current user with the given options.
+func (s *APIServer) handleVotePoll(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		OptionIDs []uuid.UUID `json:"option_ids"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	msg, poll, ok := s.pollFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(!poll.IsClosed(), "poll", "is closed")
+	data.ValidatePollVote(v, poll, input.OptionIDs)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.MessagePoll.Vote(r.Context(), msg.ID, user.ID, input.OptionIDs)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPollClosed):
+			v.AddError("poll", "is closed")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrPollSingleChoice):
+			v.AddError("option_ids", "must contain a single option")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poll, err = s.models.MessagePoll.Get(r.Context(), msg.ID, user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"poll": poll}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleRetractPollVote handles the DELETE /messages/:message_id/poll/votes endpoint.
+// It removes the current user's vote from an open poll.
+func (s *APIServer) handleRetractPollVote(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	msg, poll, ok := s.pollFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(!poll.IsClosed(), "poll", "is closed"); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.MessagePoll.Retract(r.Context(), msg.ID, user.ID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPollClosed):
+			v.AddError("poll", "is closed")
+			s.failedValidationResponse(w, r, v.Errors())
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClosePoll handles the POST /messages/:message_id/poll/close endpoint.
+// Only the sender of the poll can close it.
+func (s *APIServer) handleClosePoll(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	msg, _, ok := s.pollFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if msg.SenderID == nil || *msg.SenderID != user.ID {
+		s.permissionDeniedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.MessagePoll.Close(r.Context(), msg.ID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPollClosed):
+			v.AddError("poll", "is closed")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poll, err := s.models.MessagePoll.Get(r.Context(), msg.ID, user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"poll": poll}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
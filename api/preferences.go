@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// updatePreferences handles PATCH requests on the preferences endpoints of all conversation types.
+// An empty muted_until unmutes the conversation.
+func (s *APIServer) updatePreferences(w http.ResponseWriter, r *http.Request, conversationType string) {
+	var input struct {
+		MutedUntil *string `json:"muted_until"`
+		Pinned     *bool   `json:"pinned"`
+		Archived   *bool   `json:"archived"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	conversationID, _, ok := s.participantConversationFromRequest(w, r, conversationType)
+	if !ok {
+		return
+	}
+
+	preferences, err := s.models.ConversationPreferences.Get(r.Context(), conversationID, user.ID)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.MutedUntil != nil {
+		switch *input.MutedUntil {
+		case "":
+			preferences.MutedUntil = nil
+		default:
+			mutedUntil, err := time.Parse(time.RFC3339, *input.MutedUntil)
+			if err != nil {
+				v.AddError("muted_until", "must be an RFC 3339 time")
+				break
+			}
+
+			preferences.MutedUntil = &mutedUntil
+		}
+	}
+
+	if input.Pinned != nil {
+		preferences.Pinned = *input.Pinned
+	}
+
+	if input.Archived != nil {
+		preferences.Archived = *input.Archived
+	}
+
+	if data.ValidateConversationPreferences(v, preferences); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err = s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationPreferences.Upsert(r.Context(), preferences)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPinLimitReached):
+			v.AddError("pinned", fmt.Sprintf("must not exceed %d pinned conversations", data.MaxPinnedConversations))
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// markRead handles POST requests on the read endpoints of all conversation types.
+// Marking a conversation as read starts tracking whether it's unread for the current user.
+func (s *APIServer) markRead(w http.ResponseWriter, r *http.Request, conversationType string) {
+	conversationID, _, ok := s.participantConversationFromRequest(w, r, conversationType)
+	if !ok {
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		return tx.ConversationPreferences.MarkRead(r.Context(), conversationID, s.contextGetUser(r).ID)
+	})
+
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUpdatePrivatePreferences handles the PATCH /conversations/private/:other_user_id/preferences endpoint.
+func (s *APIServer) handleUpdatePrivatePreferences(w http.ResponseWriter, r *http.Request) {
+	s.updatePreferences(w, r, data.ConversationTypePrivate)
+}
+
+// handleUpdateGroupPreferences handles the PATCH /conversations/group/:group_id/preferences endpoint.
+func (s *APIServer) handleUpdateGroupPreferences(w http.ResponseWriter, r *http.Request) {
+	s.updatePreferences(w, r, data.ConversationTypeGroup)
+}
+
+// handleUpdateChannelPreferences handles the PATCH /conversations/channel/:channel_id/preferences endpoint.
+func (s *APIServer) handleUpdateChannelPreferences(w http.ResponseWriter, r *http.Request) {
+	s.updatePreferences(w, r, data.ConversationTypeChannel)
+}
+
+// handleUpdateSelfPreferences handles the PATCH /conversations/self/preferences endpoint.
+func (s *APIServer) handleUpdateSelfPreferences(w http.ResponseWriter, r *http.Request) {
+	s.updatePreferences(w, r, data.ConversationTypeSelf)
+}
+
+// handleMarkPrivateRead handles the POST /conversations/private/:other_user_id/read endpoint.
+func (s *APIServer) handleMarkPrivateRead(w http.ResponseWriter, r *http.Request) {
+	s.markRead(w, r, data.ConversationTypePrivate)
+}
+
+// handleMarkGroupRead handles the POST /conversations/group/:group_id/read endpoint.
+func (s *APIServer) handleMarkGroupRead(w http.ResponseWriter, r *http.Request) {
+	s.markRead(w, r, data.ConversationTypeGroup)
+}
+
+// handleMarkChannelRead handles the POST /conversations/channel/:channel_id/read endpoint.
+func (s *APIServer) handleMarkChannelRead(w http.ResponseWriter, r *http.Request) {
+	s.markRead(w, r, data.ConversationTypeChannel)
+}
+
+// handleMarkSelfRead handles the POST /conversations/self/read endpoint.
+func (s *APIServer) handleMarkSelfRead(w http.ResponseWriter, r *http.Request) {
+	s.markRead(w, r, data.ConversationTypeSelf)
+}
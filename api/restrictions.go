@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// handleMuteGroupParticipant handles the POST /conversations/group/:group_id/mutes endpoint.
+// Muted participants can still read the group but can't post to it.
+func (s *APIServer) handleMuteGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.restrictGroupMember(w, r, data.RestrictionMute)
+}
+
+// handleBanGroupParticipant handles the POST /conversations/group/:group_id/bans endpoint.
+// Banned users are removed from the group and can't be added back by anyone until they are unbanned.
+// Users who aren't participants can be banned too, so they can't join.
+func (s *APIServer) handleBanGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.restrictGroupMember(w, r, data.RestrictionBan)
+}
+
+// restrictGroupMember mutes or bans a user in a group, optionally until the given time.
+// Owners and admins can only restrict participants with a lower role than theirs.
+func (s *APIServer) restrictGroupMember(w http.ResponseWriter, r *http.Request, restrictionType string) {
+	var input struct {
+		UserID    uuid.UUID  `json:"user_id"`
+		Reason    *string    `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := s.readJSON(w, r, &input); err != nil {
+		s.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	role, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionRestrictMembers)
+	if !ok {
+		return
+	}
+
+	restriction := &data.GroupRestriction{
+		ConversationID: *groupID,
+		UserID:         input.UserID,
+		Type:           restrictionType,
+		Reason:         input.Reason,
+		CreatedBy:      user.ID,
+		ExpiresAt:      input.ExpiresAt,
+	}
+
+	v.Check(input.UserID != uuid.Nil, "user_id", "must be provided")
+	v.Check(input.UserID != user.ID, "user_id", "must not be the current user")
+
+	if data.ValidateGroupRestriction(v, restriction); !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	err := s.models.Transaction(r.Context(), func(tx *data.Models) error {
+		if err := tx.Conversation.Lock(r.Context(), *groupID); err != nil {
+			return err
+		}
+
+		participantRole, err := tx.ConversationParticipant.GetRole(r.Context(), input.UserID, *groupID, data.ConversationTypeGroup)
+
+		isParticipant := true
+
+		switch {
+		// Only participants can be muted, but anyone can be banned.
+		case errors.Is(err, data.ErrNoRecordFound) && restrictionType == data.RestrictionBan:
+			isParticipant = false
+		case err != nil:
+			return err
+		}
+
+		if isParticipant && !data.RoleOutranks(role, participantRole) {
+			return errPermissionDenied
+		}
+
+		if err := tx.GroupRestriction.Upsert(r.Context(), restriction); err != nil {
+			return err
+		}
+
+		if restrictionType != data.RestrictionBan || !isParticipant {
+			return nil
+		}
+
+		if err := tx.ConversationParticipant.RemoveParticipant(r.Context(), *groupID, input.UserID); err != nil {
+			return err
+		}
+
+		return tx.ConversationMessage.Insert(r.Context(), data.NewSystemMessage(*groupID, user.ID, data.EventParticipantBanned, &input.UserID))
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		case errors.Is(err, errPermissionDenied):
+			s.permissionDeniedResponse(w, r)
+		case errors.Is(err, data.ErrUserDoesNotExist):
+			v.AddError("user_id", "does not exist")
+			s.failedValidationResponse(w, r, v.Errors())
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusCreated, envelope{restrictionType: restriction}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleListGroupMutes handles the GET /conversations/group/:group_id/mutes endpoint.
+func (s *APIServer) handleListGroupMutes(w http.ResponseWriter, r *http.Request) {
+	s.listGroupRestrictions(w, r, data.RestrictionMute, "mutes")
+}
+
+// handleListGroupBans handles the GET /conversations/group/:group_id/bans endpoint.
+func (s *APIServer) handleListGroupBans(w http.ResponseWriter, r *http.Request) {
+	s.listGroupRestrictions(w, r, data.RestrictionBan, "bans")
+}
+
+// listGroupRestrictions lists the restrictions of the given type in effect in a group to its owner and admins.
+func (s *APIServer) listGroupRestrictions(w http.ResponseWriter, r *http.Request, restrictionType, key string) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionRestrictMembers); !ok {
+		return
+	}
+
+	restrictions, err := s.models.GroupRestriction.GetAllForGroup(r.Context(), *groupID, restrictionType)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{key: restrictions}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// handleUnmuteGroupParticipant handles the DELETE /conversations/group/:group_id/mutes/:user_id endpoint.
+func (s *APIServer) handleUnmuteGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.liftGroupRestriction(w, r, data.RestrictionMute)
+}
+
+// handleUnbanGroupParticipant handles the DELETE /conversations/group/:group_id/bans/:user_id endpoint.
+// Unbanned users aren't added back, they can join again like anyone else.
+func (s *APIServer) handleUnbanGroupParticipant(w http.ResponseWriter, r *http.Request) {
+	s.liftGroupRestriction(w, r, data.RestrictionBan)
+}
+
+// liftGroupRestriction removes a mute or ban before it expires.
+func (s *APIServer) liftGroupRestriction(w http.ResponseWriter, r *http.Request, restrictionType string) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	groupID := s.readUUIDParam("group_id", r, v)
+	restrictedUserID := s.readUUIDParam("user_id", r, v)
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	if _, ok := s.authorizeGroup(w, r, *groupID, user.ID, data.PermissionRestrictMembers); !ok {
+		return
+	}
+
+	if err := s.models.GroupRestriction.Lift(r.Context(), *groupID, *restrictedUserID, restrictionType); err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			s.notFoundResponse(w, r)
+		default:
+			s.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
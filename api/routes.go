@@ -20,17 +20,113 @@ func (s *APIServer) routes() http.Handler {
 	// Users
 	router.RegisterHandlerFunc(http.MethodPost, "/users", s.handleCreateUser)
 	router.RegisterHandlerFunc(http.MethodPost, "/users/account/activate", s.handleActivateUserAccount)
+	router.RegisterHandlerFunc(http.MethodGet, "/users/me/starred", s.requireActivatedUser(s.handleListStarredMessages))
+
+	// Groups
+	router.RegisterHandlerFunc(http.MethodGet, "/groups/discover", s.requireActivatedUser(s.handleDiscoverGroups))
 
 	// Conversations
 	router.RegisterHandlerFunc(http.MethodGet, "/conversations", s.requireActivatedUser(s.handleListConversations))
-	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group", s.requireActivatedUser(s.handleCreateGroup))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group", s.requireActivatedUser(s.idempotent(s.handleCreateGroup)))
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/group/:group_id", s.requireActivatedUser(s.handleUpdateGroup))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id", s.requireActivatedUser(s.handleDeleteGroup))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/settings", s.requireActivatedUser(s.handleGetGroupSettings))
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/group/:group_id/settings", s.requireActivatedUser(s.handleUpdateGroupSettings))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/participants", s.requireActivatedUser(s.handleListGroupParticipants))
 	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/participants", s.requireActivatedUser(s.handleAddGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id/participants/:user_id", s.requireActivatedUser(s.handleRemoveGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/participants/:user_id/promote", s.requireActivatedUser(s.handlePromoteGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/participants/:user_id/demote", s.requireActivatedUser(s.handleDemoteGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/leave", s.requireActivatedUser(s.handleLeaveGroup))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/transfer-ownership", s.requireActivatedUser(s.handleTransferGroupOwnership))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/preview", s.requireActivatedUser(s.handlePreviewGroup))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/join", s.requireActivatedUser(s.handleJoinPublicGroup))
+
+	// Channels
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel", s.requireActivatedUser(s.idempotent(s.handleCreateChannel)))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/subscribe", s.requireActivatedUser(s.handleSubscribeChannel))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/unsubscribe", s.requireActivatedUser(s.handleUnsubscribeChannel))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/channel/:channel_id/subscribers", s.requireActivatedUser(s.handleListChannelSubscribers))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/subscribers/:user_id/promote", s.requireActivatedUser(s.handlePromoteChannelSubscriber))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/subscribers/:user_id/demote", s.requireActivatedUser(s.handleDemoteChannelSubscriber))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/channel/:channel_id/messages", s.requireActivatedUser(s.handleListChannelMessages))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/messages", s.requireActivatedUser(s.idempotent(s.handleCreateChannelMessage)))
+
+	// Restrictions
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/mutes", s.requireActivatedUser(s.handleListGroupMutes))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/mutes", s.requireActivatedUser(s.handleMuteGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id/mutes/:user_id", s.requireActivatedUser(s.handleUnmuteGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/bans", s.requireActivatedUser(s.handleListGroupBans))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/bans", s.requireActivatedUser(s.handleBanGroupParticipant))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id/bans/:user_id", s.requireActivatedUser(s.handleUnbanGroupParticipant))
+
+	// Invites
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/invites", s.requireActivatedUser(s.handleListGroupInvites))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/invites", s.requireActivatedUser(s.handleCreateGroupInvite))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id/invites/:invite_id", s.requireActivatedUser(s.handleRevokeGroupInvite))
+	router.RegisterHandlerFunc(http.MethodGet, "/invites/:code", s.requireActivatedUser(s.handlePreviewGroupInvite))
+	router.RegisterHandlerFunc(http.MethodPost, "/invites/:code/join", s.requireActivatedUser(s.handleJoinGroupWithInvite))
+
+	// Join Requests
+	router.RegisterHandlerFunc(http.MethodPost, "/invites/:code/requests", s.requireActivatedUser(s.handleCreateJoinRequest))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/requests", s.requireActivatedUser(s.handleListJoinRequests))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/requests/:request_id/approve", s.requireActivatedUser(s.handleApproveJoinRequest))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/requests/:request_id/reject", s.requireActivatedUser(s.handleRejectJoinRequest))
 
 	// Conversation Messages
 	router.RegisterHandlerFunc(http.MethodGet, "/conversations/private/:other_user_id/messages", s.requireActivatedUser(s.handleListPrivateConversationMessages))
-	router.RegisterHandlerFunc(http.MethodPost, "/conversations/private/:other_user_id/messages", s.requireActivatedUser(s.handleCreatePrivateMessage))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/private/:other_user_id/messages", s.requireActivatedUser(s.idempotent(s.handleCreatePrivateMessage)))
+	router.RegisterHandlerFunc(http.MethodGet, "/conversations/self/messages", s.requireActivatedUser(s.handleListSelfMessages))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/self/messages", s.requireActivatedUser(s.idempotent(s.handleCreateSelfMessage)))
 	router.RegisterHandlerFunc(http.MethodGet, "/conversations/group/:group_id/messages", s.requireActivatedUser(s.handleListGroupMessages))
-	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/messages", s.requireActivatedUser(s.handleCreateGroupMessage))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/messages", s.requireActivatedUser(s.idempotent(s.handleCreateGroupMessage)))
+
+	// Drafts
+	router.RegisterHandlerFunc(http.MethodPut, "/conversations/private/:other_user_id/draft", s.requireActivatedUser(s.handleSavePrivateDraft))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/private/:other_user_id/draft", s.requireActivatedUser(s.handleDeletePrivateDraft))
+	router.RegisterHandlerFunc(http.MethodPut, "/conversations/group/:group_id/draft", s.requireActivatedUser(s.handleSaveGroupDraft))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/group/:group_id/draft", s.requireActivatedUser(s.handleDeleteGroupDraft))
+	router.RegisterHandlerFunc(http.MethodPut, "/conversations/self/draft", s.requireActivatedUser(s.handleSaveSelfDraft))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/self/draft", s.requireActivatedUser(s.handleDeleteSelfDraft))
+
+	// Preferences
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/private/:other_user_id/preferences", s.requireActivatedUser(s.handleUpdatePrivatePreferences))
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/group/:group_id/preferences", s.requireActivatedUser(s.handleUpdateGroupPreferences))
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/channel/:channel_id/preferences", s.requireActivatedUser(s.handleUpdateChannelPreferences))
+	router.RegisterHandlerFunc(http.MethodPatch, "/conversations/self/preferences", s.requireActivatedUser(s.handleUpdateSelfPreferences))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/private/:other_user_id/read", s.requireActivatedUser(s.handleMarkPrivateRead))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/read", s.requireActivatedUser(s.handleMarkGroupRead))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/read", s.requireActivatedUser(s.handleMarkChannelRead))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/self/read", s.requireActivatedUser(s.handleMarkSelfRead))
+
+	// History
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/private/:other_user_id/clear", s.requireActivatedUser(s.handleClearPrivateHistory))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/group/:group_id/clear", s.requireActivatedUser(s.handleClearGroupHistory))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/channel/:channel_id/clear", s.requireActivatedUser(s.handleClearChannelHistory))
+	router.RegisterHandlerFunc(http.MethodPost, "/conversations/self/clear", s.requireActivatedUser(s.handleClearSelfHistory))
+	router.RegisterHandlerFunc(http.MethodDelete, "/conversations/private/:other_user_id", s.requireActivatedUser(s.handleDeletePrivateConversation))
+
+	// Folders
+	router.RegisterHandlerFunc(http.MethodGet, "/users/me/folders", s.requireActivatedUser(s.handleListFolders))
+	router.RegisterHandlerFunc(http.MethodPost, "/users/me/folders", s.requireActivatedUser(s.idempotent(s.handleCreateFolder)))
+	router.RegisterHandlerFunc(http.MethodPut, "/users/me/folders/order", s.requireActivatedUser(s.handleReorderFolders))
+	router.RegisterHandlerFunc(http.MethodPatch, "/users/me/folders/:folder_id", s.requireActivatedUser(s.handleUpdateFolder))
+	router.RegisterHandlerFunc(http.MethodDelete, "/users/me/folders/:folder_id", s.requireActivatedUser(s.handleDeleteFolder))
+	router.RegisterHandlerFunc(http.MethodPost, "/users/me/folders/:folder_id/conversations", s.requireActivatedUser(s.handleAddFolderConversation))
+	router.RegisterHandlerFunc(http.MethodDelete, "/users/me/folders/:folder_id/conversations/:conversation_id", s.requireActivatedUser(s.handleRemoveFolderConversation))
+
+	// Messages
+	router.RegisterHandlerFunc(http.MethodPatch, "/messages/:message_id/location", s.requireActivatedUser(s.handleUpdateLiveLocation))
+	router.RegisterHandlerFunc(http.MethodPost, "/messages/:message_id/star", s.requireActivatedUser(s.handleStarMessage))
+	router.RegisterHandlerFunc(http.MethodDelete, "/messages/:message_id/star", s.requireActivatedUser(s.handleUnstarMessage))
+
+	// Polls
+	router.RegisterHandlerFunc(http.MethodPost, "/messages/:message_id/poll/votes", s.requireActivatedUser(s.handleVotePoll))
+	router.RegisterHandlerFunc(http.MethodDelete, "/messages/:message_id/poll/votes", s.requireActivatedUser(s.handleRetractPollVote))
+	router.RegisterHandlerFunc(http.MethodPost, "/messages/:message_id/poll/close", s.requireActivatedUser(s.handleClosePoll))
+
+	// Sync
+	router.RegisterHandlerFunc(http.MethodGet, "/sync", s.requireActivatedUser(s.handleSync))
 
 	// Middlewares
 	router.RegisterMiddlewares(
@@ -14,23 +14,47 @@ import (
 
 	"github.com/thisisjab/gchat-go/internal/data"
 	"github.com/thisisjab/gchat-go/internal/mailer"
+	"github.com/thisisjab/gchat-go/internal/unfurl"
 )
 
 type APIServer struct {
-	config *Config
-	mailer *mailer.Mailer
-	models *data.Models
-	logger *slog.Logger
-	wg     sync.WaitGroup
+	config   *Config
+	mailer   *mailer.Mailer
+	models   *data.Models
+	logger   *slog.Logger
+	unfurler unfurl.Fetcher
+	wg       sync.WaitGroup
+	// stopping is cancelled on shutdown, by stop, to end background tasks early.
+	stopping context.Context
+	stop     context.CancelFunc
 }
 
 type Config struct {
+	Conversations struct {
+		AllowDeleteForBoth bool
+	}
 	Cors struct {
 		AllowedHeaders string
 		AllowedMethods string
 		TrustedOrigins []string
 	}
 	Environment string
+	Groups      struct {
+		OwnershipTransferRequiresPassword bool
+		JoinRequestsPerHour               int
+		JoinRequestTTL                    time.Duration
+		MaxMembers                        int
+	}
+	LinkPreviews struct {
+		Enabled      bool
+		Timeout      time.Duration
+		MaxBodyBytes int64
+		CacheTTL     time.Duration
+		FailureTTL   time.Duration
+	}
+	Messages struct {
+		MaxContentLength int
+	}
 	Port        int
 	RateLimiter struct {
 		Rps     int
@@ -41,11 +65,20 @@ type Config struct {
 }
 
 func NewServer(cfg *Config, db *sql.DB, mailer *mailer.Mailer, logger *slog.Logger) *APIServer {
+	stopping, stop := context.WithCancel(context.Background())
+
 	return &APIServer{
 		config: cfg,
 		mailer: mailer,
 		models: data.NewModels(db),
 		logger: logger,
+		unfurler: unfurl.NewHTTPFetcher(unfurl.Config{
+			Timeout:      cfg.LinkPreviews.Timeout,
+			MaxBodyBytes: cfg.LinkPreviews.MaxBodyBytes,
+			MaxRedirects: 3,
+		}),
+		stopping: stopping,
+		stop:     stop,
 	}
 }
 
@@ -79,11 +112,15 @@ func (s *APIServer) Start() error {
 		}
 
 		s.logger.Info("completing background tasks", "addr", srv.Addr)
+		s.stop()
 		s.wg.Wait()
 
 		shutdownErr <- nil
 	}()
 
+	s.purgeDeletedConversations()
+	s.purgeExpiredIdempotencyKeys(s.stopping.Done())
+
 	s.logger.Info("starting server", "addr", srv.Addr, "env", s.config.Environment)
 
 	err := srv.ListenAndServe()
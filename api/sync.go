@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/data"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const (
+	defaultSyncBatchSize = 100
+	maxSyncBatchSize     = 500
+)
+
+// syncChange is a change as returned to syncing clients, along with the current state of the changed entity.
+// Entities that no longer exist are reported as deleted.
+type syncChange struct {
+	Entity         string                        `json:"entity"`
+	EntityID       uuid.UUID                     `json:"entity_id"`
+	Action         string                        `json:"action"`
+	ConversationID uuid.UUID                     `json:"conversation_id"`
+	UserID         *uuid.UUID                    `json:"user_id,omitempty"`
+	Conversation   *data.Conversation            `json:"conversation,omitempty"`
+	Message        *data.ConversationMessage     `json:"message,omitempty"`
+	Folder         *data.ConversationFolder      `json:"folder,omitempty"`
+	Preferences    *data.ConversationPreferences `json:"preferences,omitempty"`
+}
+
+// encodeSyncToken returns the opaque sync token of a change log position.
+func encodeSyncToken(position data.ChangePosition) string {
+	raw := strconv.FormatUint(position.TxID, 10) + "." + strconv.FormatInt(position.Seq, 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeSyncToken returns the change log position of a sync token.
+// An empty token means syncing from the beginning. Tokens holding only a sequence number were issued before
+// changes had transaction ids, which are all zero for the changes written back then.
+func decodeSyncToken(token string) (data.ChangePosition, bool) {
+	var position data.ChangePosition
+
+	if token == "" {
+		return position, true
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return position, false
+	}
+
+	txID, seq, found := strings.Cut(string(raw), ".")
+	if !found {
+		txID, seq = "0", txID
+	}
+
+	if position.TxID, err = strconv.ParseUint(txID, 10, 64); err != nil {
+		return position, false
+	}
+
+	if position.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil || position.Seq < 0 {
+		return position, false
+	}
+
+	return position, true
+}
+
+// handleSync handles the GET /sync endpoint.
+// It returns what changed since the given sync token in the conversations the current user is in,
+// in batches. Clients call it again with next_token while has_more is true.
+func (s *APIServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	v := validator.New()
+
+	token := s.readStringQuery(r.URL.Query(), "since", "")
+	limit := s.readIntQuery(r.URL.Query(), "limit", defaultSyncBatchSize, v)
+
+	since, ok := decodeSyncToken(token)
+	v.Check(ok, "since", "must be a valid sync token")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= maxSyncBatchSize, "limit", "must be a maximum of 500")
+
+	if !v.Valid() {
+		s.failedValidationResponse(w, r, v.Errors())
+		return
+	}
+
+	changes, hasMore, err := s.models.Change.GetSince(r.Context(), user.ID, since, limit)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The token is only advanced when there are changes, so clients can keep polling with it.
+	if len(changes) > 0 {
+		token = encodeSyncToken(changes[len(changes)-1].Position())
+	}
+
+	result, err := s.syncChanges(r, user.ID, changes)
+	if err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := s.writeJSON(w, http.StatusOK, envelope{"changes": result, "next_token": token, "has_more": hasMore}, nil); err != nil {
+		s.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// syncChanges collapses multiple changes of the same entity into its latest one and attaches
+// the current state of changed conversations, messages, folders and preferences.
+func (s *APIServer) syncChanges(r *http.Request, userID uuid.UUID, changes []*data.Change) ([]*syncChange, error) {
+	type entityKey struct {
+		entity         string
+		entityID       uuid.UUID
+		conversationID uuid.UUID
+	}
+
+	latest := make(map[entityKey]int, len(changes))
+
+	for i, c := range changes {
+		latest[entityKey{c.Entity, c.EntityID, c.ConversationID}] = i
+	}
+
+	var conversationIDs, messageIDs, folderIDs, preferencesIDs []uuid.UUID
+
+	for i, c := range changes {
+		if latest[entityKey{c.Entity, c.EntityID, c.ConversationID}] != i {
+			continue
+		}
+
+		switch c.Entity {
+		case data.ChangeEntityConversation:
+			conversationIDs = append(conversationIDs, c.EntityID)
+		case data.ChangeEntityMessage:
+			messageIDs = append(messageIDs, c.EntityID)
+		case data.ChangeEntityFolder:
+			folderIDs = append(folderIDs, c.EntityID)
+		case data.ChangeEntityPreferences:
+			preferencesIDs = append(preferencesIDs, c.EntityID)
+		}
+	}
+
+	conversations, err := s.models.Conversation.GetMany(r.Context(), conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.models.ConversationMessage.GetMany(r.Context(), messageIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := s.models.ConversationFolder.GetMany(r.Context(), userID, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences, err := s.models.ConversationPreferences.GetMany(r.Context(), userID, preferencesIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*syncChange, 0, len(latest))
+
+	for i, c := range changes {
+		if latest[entityKey{c.Entity, c.EntityID, c.ConversationID}] != i {
+			continue
+		}
+
+		change := &syncChange{
+			Entity:         c.Entity,
+			EntityID:       c.EntityID,
+			Action:         c.Action,
+			ConversationID: c.ConversationID,
+			UserID:         c.UserID,
+		}
+
+		switch c.Entity {
+		case data.ChangeEntityConversation:
+			change.Conversation = conversations[c.EntityID]
+			if change.Conversation == nil {
+				change.Action = data.ChangeActionDeleted
+			}
+		case data.ChangeEntityMessage:
+			change.Message = messages[c.EntityID]
+			if change.Message == nil {
+				change.Action = data.ChangeActionDeleted
+			}
+		case data.ChangeEntityFolder:
+			change.Folder = folders[c.EntityID]
+			if change.Folder == nil {
+				change.Action = data.ChangeActionDeleted
+			}
+		case data.ChangeEntityPreferences:
+			change.Preferences = preferences[c.EntityID]
+			if change.Preferences == nil {
+				change.Action = data.ChangeActionDeleted
+			}
+		}
+
+		result = append(result, change)
+	}
+
+	return result, nil
+}
@@ -32,6 +32,11 @@ func main() {
 
 	logger := setupLogger(*logLevel)
 
+	if apiCfg.Groups.MaxMembers <= 0 {
+		logger.Error("invalid config", "error", "groups-max-members must be greater than zero")
+		os.Exit(1)
+	}
+
 	database, err := database.OpenDB(*dbCfg)
 	if err != nil {
 		logger.Error("failed to open database", "error", err)
@@ -71,8 +76,11 @@ func loadAPIConfig(env *envreader.EnvReader, cfg *api.Config) {
 	flag.IntVar(&cfg.Port, "port", env.Int("PORT", 8000), "server port")
 	flag.StringVar(&cfg.Version, "version", env.String("VERSION", "1.0"), "server version (1.0 by default).")
 
+	// Conversations
+	flag.BoolVar(&cfg.Conversations.AllowDeleteForBoth, "conversations-allow-delete-for-both", env.Bool("CONVERSATIONS_ALLOW_DELETE_FOR_BOTH", true), "allow deleting private conversations for both users (true by default)")
+
 	// CORS
-	flag.StringVar(&cfg.Cors.AllowedHeaders, "cors-allowed-headers", env.String("CORS_ALLOWED_HEADERS", "Content-Type, Authorization"), "allowed CORS headers (comma separated)")
+	flag.StringVar(&cfg.Cors.AllowedHeaders, "cors-allowed-headers", env.String("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, Idempotency-Key"), "allowed CORS headers (comma separated)")
 	flag.StringVar(&cfg.Cors.AllowedMethods, "cors-allowed-methods", env.String("CORS_ALLOWED_METHODS", "POST, PATCH, DELETE"), "allowed CORS methods (comma separated)")
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		if val == "" {
@@ -84,6 +92,22 @@ func loadAPIConfig(env *envreader.EnvReader, cfg *api.Config) {
 		return nil
 	})
 
+	// Groups
+	flag.BoolVar(&cfg.Groups.OwnershipTransferRequiresPassword, "groups-ownership-transfer-requires-password", env.Bool("GROUPS_OWNERSHIP_TRANSFER_REQUIRES_PASSWORD", true), "require the owner's password to transfer group ownership (true by default)")
+	flag.IntVar(&cfg.Groups.JoinRequestsPerHour, "groups-join-requests-per-hour", env.Int("GROUPS_JOIN_REQUESTS_PER_HOUR", 10), "max group join requests a user can submit per hour (default: 10)")
+	flag.DurationVar(&cfg.Groups.JoinRequestTTL, "groups-join-request-ttl", env.Duration("GROUPS_JOIN_REQUEST_TTL", 7*24*time.Hour), "time after which pending group join requests expire (default: 7 days)")
+	flag.IntVar(&cfg.Groups.MaxMembers, "groups-max-members", env.Int("GROUPS_MAX_MEMBERS", 10000), "max participants a group can have (default: 10000)")
+
+	// Link Previews
+	flag.BoolVar(&cfg.LinkPreviews.Enabled, "link-previews-enabled", env.Bool("LINK_PREVIEWS_ENABLED", true), "link previews enabled (true by default)")
+	flag.DurationVar(&cfg.LinkPreviews.Timeout, "link-previews-timeout", env.Duration("LINK_PREVIEWS_TIMEOUT", 5*time.Second), "link preview fetch timeout (default: 5 seconds)")
+	flag.Int64Var(&cfg.LinkPreviews.MaxBodyBytes, "link-previews-max-body-bytes", int64(env.Int("LINK_PREVIEWS_MAX_BODY_BYTES", 512*1024)), "max bytes read from a page for link previews (default: 512KB)")
+	flag.DurationVar(&cfg.LinkPreviews.CacheTTL, "link-previews-cache-ttl", env.Duration("LINK_PREVIEWS_CACHE_TTL", 24*time.Hour), "link preview cache ttl (default: 24 hours)")
+	flag.DurationVar(&cfg.LinkPreviews.FailureTTL, "link-previews-failure-ttl", env.Duration("LINK_PREVIEWS_FAILURE_TTL", 10*time.Minute), "how long urls which could not be previewed are not fetched again (default: 10 minutes)")
+
+	// Messages
+	flag.IntVar(&cfg.Messages.MaxContentLength, "messages-max-content-length", env.Int("MESSAGES_MAX_CONTENT_LENGTH", 500), "max characters in message content (default: 500)")
+
 	// Rate Limiter
 	flag.IntVar(&cfg.RateLimiter.Rps, "rate-limiter-rps", env.Int("RATE_LIMITER_RPS", 4), "rate limiter requests per second")
 	flag.IntVar(&cfg.RateLimiter.Burst, "rate-limiter-burst", env.Int("RATE_LIMITER_BURST", 2), "rate limiter burst size")
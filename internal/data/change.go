@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChangeEntityConversation = "conversation"
+	ChangeEntityMessage      = "message"
+	ChangeEntityParticipant  = "participant"
+	// ChangeEntitySubscription is a membership of a channel, which is only synced to the subscriber
+	// since channels can have too many subscribers to tell all of them about each other.
+	ChangeEntitySubscription = "subscription"
+	// ChangeEntityFolder is a conversation folder of a user, which is in no conversation
+	// and has a nil conversation id. It's only synced to its owner.
+	ChangeEntityFolder = "folder"
+	// ChangeEntityPreferences are the preferences of a user for a conversation, identified by the conversation.
+	// They're only synced to the user.
+	ChangeEntityPreferences = "preferences"
+)
+
+const (
+	ChangeActionCreated = "created"
+	ChangeActionUpdated = "updated"
+	ChangeActionDeleted = "deleted"
+)
+
+// Change is an entry of the change log.
+// Changes are ordered by the id of the transaction that wrote them, then by sequence number.
+type Change struct {
+	TxID           uint64
+	Seq            int64
+	ConversationID uuid.UUID
+	Entity         string
+	EntityID       uuid.UUID
+	Action         string
+	UserID         *uuid.UUID
+	CreatedAt      time.Time
+}
+
+type ChangeModel struct {
+	DB DBOperator
+}
+
+// ChangePosition is a position in the change log, i.e. the transaction id and sequence number of the last change read.
+// The zero position is the beginning of the change log.
+type ChangePosition struct {
+	TxID uint64
+	Seq  int64
+}
+
+// Position returns the position of the change in the change log.
+func (c *Change) Position() ChangePosition {
+	return ChangePosition{TxID: c.TxID, Seq: c.Seq}
+}
+
+// recordChange appends a change to the change log.
+// Models call it whenever they change something clients sync, preferably in the same transaction.
+func recordChange(ctx context.Context, db DBOperator, change Change) error {
+	query := `
+	INSERT INTO change_log (conversation_id, entity, entity_id, action, user_id)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	args := []any{change.ConversationID, change.Entity, change.EntityID, change.Action, change.UserID}
+
+	_, err := db.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// GetSince returns up to limit changes after the given position, in order, for conversations
+// the user participates in along with changes of the user's own memberships, folders and preferences.
+// It also reports whether more changes are available.
+//
+// Writers don't wait for each other, so changes may commit out of order. Only changes of transactions older than
+// every transaction still running are returned: no change can be written before them anymore, so clients syncing
+// from a position never skip a change committed after they read past it.
+func (m *ChangeModel) GetSince(ctx context.Context, userID uuid.UUID, since ChangePosition, limit int) ([]*Change, bool, error) {
+	query := `
+	SELECT cl.txid, cl.seq, cl.conversation_id, cl.entity, cl.entity_id, cl.action, cl.user_id, cl.created_at
+	FROM change_log cl
+	WHERE (cl.txid, cl.seq) > ($2::xid8, $3)
+	AND cl.txid < pg_snapshot_xmin(pg_current_snapshot())
+	AND (
+		(
+			cl.conversation_id IN (SELECT cp.conversation_id FROM conversation_participants cp WHERE cp.user_id = $1)
+			AND cl.entity NOT IN ('subscription', 'preferences')
+		)
+		OR cl.user_id = $1
+	)
+	ORDER BY cl.txid, cl.seq
+	LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// One extra change is read to know whether there are more.
+	rows, err := m.DB.QueryContext(ctx, query, userID, since.TxID, since.Seq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rows.Close()
+
+	changes := make([]*Change, 0, limit)
+
+	for rows.Next() {
+		var c Change
+
+		err := rows.Scan(&c.TxID, &c.Seq, &c.ConversationID, &c.Entity, &c.EntityID, &c.Action, &c.UserID, &c.CreatedAt)
+		if err != nil {
+			return nil, false, err
+		}
+
+		changes = append(changes, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+
+	return changes, hasMore, nil
+}
+
+// recordMessageChange appends a change of the message to the change log, looking up its conversation.
+func recordMessageChange(ctx context.Context, db DBOperator, messageID uuid.UUID, action string) error {
+	query := `
+	INSERT INTO change_log (conversation_id, entity, entity_id, action)
+	SELECT m.conversation_id, $1, m.id, $2
+	FROM conversation_messages m
+	WHERE m.id = $3
+	`
+
+	_, err := db.ExecContext(ctx, query, ChangeEntityMessage, action, messageID)
+
+	return err
+}
+
+// recordParticipantsRemoved appends a removal of each participant of the conversation to the change log,
+// so they're told about it even once they no longer participate in it.
+func recordParticipantsRemoved(ctx context.Context, db DBOperator, conversationID uuid.UUID) error {
+	query := `
+	INSERT INTO change_log (conversation_id, entity, entity_id, action, user_id)
+	SELECT cp.conversation_id, $1, cp.user_id, $2, cp.user_id
+	FROM conversation_participants cp
+	WHERE cp.conversation_id = $3
+	`
+
+	_, err := db.ExecContext(ctx, query, ChangeEntityParticipant, ChangeActionDeleted, conversationID)
+
+	return err
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/thisisjab/gchat-go/internal/filter"
 	"github.com/thisisjab/gchat-go/internal/validator"
 )
@@ -14,6 +19,14 @@ import (
 const (
 	ConversationTypePrivate = "private"
 	ConversationTypeGroup   = "group"
+	ConversationTypeSelf    = "self"
+	// Channels are one-to-many conversations where only owners and admins post and subscribers read.
+	ConversationTypeChannel = "channel"
+)
+
+const (
+	GroupVisibilityPrivate = "private"
+	GroupVisibilityPublic  = "public"
 )
 
 type Conversation struct {
@@ -24,53 +37,108 @@ type Conversation struct {
 }
 
 type GroupMetadata struct {
-	OwnerID uuid.UUID `json:"owner_id"`
-	Name    string    `json:"name"`
+	OwnerID     uuid.UUID `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	AvatarURL   *string   `json:"avatar_url"`
+	Visibility  string    `json:"visibility"`
+	MemberCount int       `json:"member_count,omitempty"` // Only loaded when getting a single group or channel, or listing public groups.
 }
 
 type ConversationModel struct {
 	DB DBOperator
 }
 
+// nullableGroupMetadata holds scanned group metadata columns, which are NULL for conversations other than groups.
+type nullableGroupMetadata struct {
+	ownerID     *uuid.UUID
+	name        *string
+	description *string
+	avatarURL   *string
+	visibility  *string
+}
+
+func (g *nullableGroupMetadata) metadata() *GroupMetadata {
+	if g.ownerID == nil {
+		return nil
+	}
+
+	return &GroupMetadata{
+		OwnerID:     *g.ownerID,
+		Name:        *g.name,
+		Description: g.description,
+		AvatarURL:   g.avatarURL,
+		Visibility:  *g.visibility,
+	}
+}
+
 type ConversationWithPreview struct {
 	Conversation
-	Preview *ConversationMessage `json:"preview"`
+	Preview     *ConversationMessage    `json:"preview"`
+	Draft       *ConversationDraft      `json:"draft"`
+	Preferences ConversationPreferences `json:"preferences"`
 }
 
 var (
-	ErrConversationDoesNotExist = errors.New("non-existing conversation")
+	ErrConversationDoesNotExist  = errors.New("non-existing conversation")
+	ErrSelfConversationDuplicate = errors.New("duplicate self conversation")
 )
 
 func ValidateGroupMetadata(v *validator.Validator, metadata GroupMetadata) {
 	v.Check(metadata.Name != "", "name", "must be provided")
 	v.Check(len(metadata.Name) <= 100, "name", "must be at most 100 bytes")
+
+	if metadata.Description != nil {
+		v.Check(*metadata.Description != "", "description", "must not be empty")
+		v.Check(len(*metadata.Description) <= 1000, "description", "must be at most 1000 bytes")
+	}
+
+	v.Check(slices.Contains([]string{GroupVisibilityPrivate, GroupVisibilityPublic}, metadata.Visibility), "visibility", "must be either private or public")
+
+	if metadata.AvatarURL != nil {
+		v.Check(len(*metadata.AvatarURL) <= 2048, "avatar_url", "must be at most 2048 bytes")
+
+		u, err := url.Parse(*metadata.AvatarURL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "avatar_url", "must be a valid http or https url")
+	}
 }
 
-func (cm *ConversationModel) GetAllWithPreview(ctx context.Context, userID uuid.UUID, f filter.Filters) ([]*ConversationWithPreview, *filter.PaginationMetadata, error) {
-	query := `
+// GetAllWithPreview lists the conversations of the user along with their latest message, the user's draft and their preferences.
+// Archived conversations are listed separately from the others. If folderID is not nil, only conversations in the folder,
+// which must be the user's, are listed.
+func (cm *ConversationModel) GetAllWithPreview(ctx context.Context, userID uuid.UUID, archived bool, folderID *uuid.UUID, f filter.Filters) ([]*ConversationWithPreview, *filter.PaginationMetadata, error) {
+	query := fmt.Sprintf(`
 	SELECT
 		count(*) OVER() AS total_records,
 		c.id, c.type, c.created_at,
-		gm.name, gm.owner_id,
-		m.id, m.content, m.type, m.sender_id, m.created_at, m.updated_at
+		gm.owner_id, gm.name, gm.description, gm.avatar_url, gm.visibility,
+		m.id, m.content, m.type, m.sender_id, m.payload, m.created_at, m.updated_at,
+		d.content, d.format, d.replied_message_id, d.updated_at,
+		CASE WHEN p.muted_until > NOW() THEN p.muted_until END, p.pinned_at IS NOT NULL, coalesce(%[1]s, false),
+		p.last_read_message_id IS NOT NULL AND c.last_message_id IS DISTINCT FROM p.last_read_message_id, p.cleared_at
 	FROM conversations c
 	JOIN conversation_participants ON c.id = conversation_participants.conversation_id
 	LEFT JOIN group_metadata gm ON gm.conversation_id = c.id
-	LEFT JOIN LATERAL (
-		SELECT *
-		FROM conversation_messages
-		WHERE conversation_messages.conversation_id = c.id
-		ORDER BY conversation_messages.created_at DESC
-		LIMIT 1
-	) m ON true
-	WHERE conversation_participants.user_id = $1
+	LEFT JOIN conversation_drafts d ON d.conversation_id = c.id AND d.user_id = conversation_participants.user_id
+	LEFT JOIN conversation_preferences p ON p.conversation_id = c.id AND p.user_id = conversation_participants.user_id
+	LEFT JOIN conversation_messages m ON m.id = c.last_message_id AND (p.cleared_at IS NULL OR m.created_at > p.cleared_at)
+	LEFT JOIN conversation_folders f ON f.id = $5 AND f.user_id = conversation_participants.user_id
+	WHERE conversation_participants.user_id = $1 AND coalesce(%[1]s, false) = $4 AND (
+		$5::uuid IS NULL OR
+		c.type = ANY(f.include_types) OR
+		(f.include_unread AND p.last_read_message_id IS NOT NULL AND c.last_message_id IS DISTINCT FROM p.last_read_message_id) OR
+		EXISTS (SELECT 1 FROM conversation_folder_conversations fc WHERE fc.folder_id = f.id AND fc.conversation_id = c.id)
+	)
+	-- Saved messages are always on top, followed by pinned conversations, the most recently pinned first,
+	-- and then the most recently active conversations.
+	ORDER BY c.type = 'self' DESC, p.pinned_at DESC NULLS LAST, coalesce(m.created_at, c.created_at) DESC, c.id
 	LIMIT $2 OFFSET $3
-	`
+	`, archivedCondition)
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	args := []any{userID, f.Limit(), f.Offset()}
+	args := []any{userID, f.Limit(), f.Offset(), archived, folderID}
 
 	rows, err := cm.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -85,17 +153,24 @@ func (cm *ConversationModel) GetAllWithPreview(ctx context.Context, userID uuid.
 		var (
 			c Conversation
 
-			// Group metadata
-			groupOwnerID *uuid.UUID
-			groupName    *string
+			group nullableGroupMetadata
 
 			// Preview message
 			previewMessageID        *uuid.UUID
 			previewMessageContent   *string
 			previewMessageType      *string
 			previewMessageSenderID  *uuid.UUID
+			previewMessagePayload   []byte
 			previewMessageCreatedAt *time.Time
 			previewMessageUpdatedAt *time.Time
+
+			// Draft
+			draftContent          *string
+			draftFormat           *string
+			draftRepliedMessageID *uuid.UUID
+			draftUpdatedAt        *time.Time
+
+			preferences = ConversationPreferences{UserID: userID}
 		)
 
 		if err := rows.Scan(
@@ -105,27 +180,39 @@ func (cm *ConversationModel) GetAllWithPreview(ctx context.Context, userID uuid.
 			&c.Type,
 			&c.CreatedAt,
 			// Group metadata
-			&groupName,
-			&groupOwnerID,
+			&group.ownerID,
+			&group.name,
+			&group.description,
+			&group.avatarURL,
+			&group.visibility,
 			// Preview message
 			&previewMessageID,
 			&previewMessageContent,
 			&previewMessageType,
 			&previewMessageSenderID,
+			&previewMessagePayload,
 			&previewMessageCreatedAt,
 			&previewMessageUpdatedAt,
+			// Draft
+			&draftContent,
+			&draftFormat,
+			&draftRepliedMessageID,
+			&draftUpdatedAt,
+			// Preferences
+			&preferences.MutedUntil,
+			&preferences.Pinned,
+			&preferences.Archived,
+			&preferences.Unread,
+			&preferences.ClearedAt,
 		); err != nil {
 			return nil, nil, err
 		}
 
-		item := ConversationWithPreview{Conversation: c}
+		c.GroupMetadata = group.metadata()
 
-		if groupOwnerID != nil {
-			item.GroupMetadata = &GroupMetadata{
-				OwnerID: *groupOwnerID,
-				Name:    *groupName,
-			}
-		}
+		preferences.ConversationID = c.ID
+
+		item := ConversationWithPreview{Conversation: c, Preferences: preferences}
 
 		if previewMessageID != nil {
 			item.Preview = &ConversationMessage{
@@ -136,7 +223,27 @@ func (cm *ConversationModel) GetAllWithPreview(ctx context.Context, userID uuid.
 				},
 				Content:  *previewMessageContent,
 				Type:     *previewMessageType,
-				SenderID: *previewMessageSenderID,
+				SenderID: previewMessageSenderID,
+				// Content is stored as plain text, so previews leave the formatting entities out.
+				Format: FormatPlain,
+			}
+
+			// System messages have no content, so clients need their event to render them.
+			if item.Preview.Type == TypeSystemMessage {
+				if err := item.Preview.setPayload(previewMessagePayload); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+
+		if draftContent != nil {
+			item.Draft = &ConversationDraft{
+				UserID:           userID,
+				ConversationID:   c.ID,
+				Content:          *draftContent,
+				Format:           *draftFormat,
+				RepliedMessageID: draftRepliedMessageID,
+				UpdatedAt:        *draftUpdatedAt,
 			}
 		}
 
@@ -166,6 +273,8 @@ func (cm *ConversationModel) GetPrivateBetweenUsers(ctx context.Context, userID,
     JOIN users u2 ON u2.id = cp2.user_id
     WHERE cp1.user_id = $1
         AND cp2.user_id = $2
+        AND cp1.user_id <> cp2.user_id
+        AND c.type = 'private'
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -187,6 +296,11 @@ func (cm *ConversationModel) GetPrivateBetweenUsers(ctx context.Context, userID,
 }
 
 func (cm *ConversationModel) CreateBetweenUsers(ctx context.Context, userID, otherUserID uuid.UUID) (*Conversation, error) {
+	// A conversation with oneself is a self conversation, see CreateSelf.
+	if userID == otherUserID {
+		return nil, errors.New("private conversation requires two different users")
+	}
+
 	query := `
 	INSERT INTO conversations (type)
 	VALUES ('private')
@@ -210,6 +324,89 @@ func (cm *ConversationModel) CreateBetweenUsers(ctx context.Context, userID, oth
 		return nil, err
 	}
 
+	if err := recordConversationCreated(ctx, cm.DB, conversation.ID, userID, otherUserID); err != nil {
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+// GetSelf returns the "saved messages" conversation of the user.
+func (cm *ConversationModel) GetSelf(ctx context.Context, userID uuid.UUID) (*Conversation, error) {
+	query := `
+	SELECT c.id, c.type, c.created_at, c.updated_at, c.version
+	FROM conversations c
+	JOIN self_conversations sc ON sc.conversation_id = c.id
+	WHERE sc.user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var conversation Conversation
+
+	err := cm.DB.QueryRowContext(ctx, query, userID).Scan(
+		&conversation.ID,
+		&conversation.Type,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+		&conversation.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &conversation, nil
+}
+
+// CreateSelf creates the "saved messages" conversation of the user, having the user as its only participant.
+// It should be run in a transaction. ErrSelfConversationDuplicate is returned if the user already has one.
+func (cm *ConversationModel) CreateSelf(ctx context.Context, userID uuid.UUID) (*Conversation, error) {
+	query := `
+	INSERT INTO conversations (type)
+	VALUES ('self')
+	RETURNING id, type, created_at, updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	conversation := &Conversation{}
+
+	err := cm.DB.QueryRowContext(ctx, query).Scan(&conversation.ID, &conversation.Type, &conversation.CreatedAt, &conversation.UpdatedAt, &conversation.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO self_conversations (user_id, conversation_id) VALUES ($1, $2)`
+
+	_, err = cm.DB.ExecContext(ctx, query, userID, conversation.ID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `pq: duplicate key value violates unique constraint "self_conversations_pkey"`):
+			return nil, ErrSelfConversationDuplicate
+		default:
+			return nil, err
+		}
+	}
+
+	query = `INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2)`
+
+	_, err = cm.DB.ExecContext(ctx, query, conversation.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordConversationCreated(ctx, cm.DB, conversation.ID, userID); err != nil {
+		return nil, err
+	}
+
 	return conversation, nil
 }
 
@@ -222,6 +419,8 @@ func (cm *ConversationModel) Exists(ctx context.Context, conversationID uuid.UUI
 			c.id = $1
 		AND
 			c.type = $2
+		AND
+			c.deleted_at IS NULL
 	)
 	`
 
@@ -245,28 +444,32 @@ func (cm *ConversationModel) CreateGroup(ctx context.Context, conversation *Conv
 	query := `
 		INSERT INTO conversations (type)
 		VALUES ($1)
-		RETURNING id, created_at, updated_at
+		RETURNING id, created_at, updated_at, version
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err := cm.DB.QueryRowContext(ctx, query, conversation.Type).Scan(&conversation.ID, &conversation.CreatedAt, &conversation.UpdatedAt)
+	err := cm.DB.QueryRowContext(ctx, query, conversation.Type).Scan(&conversation.ID, &conversation.CreatedAt, &conversation.UpdatedAt, &conversation.Version)
 
 	if err != nil {
 		return err
 	}
 
-	if conversation.Type == ConversationTypeGroup {
+	if conversation.Type == ConversationTypeGroup || conversation.Type == ConversationTypeChannel {
 		if conversation.GroupMetadata == nil {
 			return errors.New("conversation group metadata is not provided")
 		}
 
+		// The member count is maintained as participants are added and removed, starting with the owner.
+		conversation.GroupMetadata.MemberCount = 1
+
 		// Create group metadata
 		query = `
-		INSERT INTO group_metadata (conversation_id, owner_id, name) VALUES ($1, $2, $3)
+		INSERT INTO group_metadata (conversation_id, owner_id, name, description, avatar_url, visibility, member_count) VALUES ($1, $2, $3, $4, $5, $6, $7)
 		`
-		_, err := cm.DB.ExecContext(ctx, query, conversation.ID, conversation.GroupMetadata.OwnerID, conversation.GroupMetadata.Name)
+		metadata := conversation.GroupMetadata
+		_, err := cm.DB.ExecContext(ctx, query, conversation.ID, metadata.OwnerID, metadata.Name, metadata.Description, metadata.AvatarURL, metadata.Visibility, metadata.MemberCount)
 
 		if err != nil {
 			return err
@@ -274,13 +477,45 @@ func (cm *ConversationModel) CreateGroup(ctx context.Context, conversation *Conv
 
 		// Add group owner to group participants
 		query = `
-		INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2)
+		INSERT INTO conversation_participants (conversation_id, user_id, role) VALUES ($1, $2, 'owner')
 		`
 		_, err = cm.DB.ExecContext(ctx, query, conversation.ID, conversation.GroupMetadata.OwnerID)
 
 		if err != nil {
 			return err
 		}
+
+		return recordConversationCreated(ctx, cm.DB, conversation.ID, conversation.GroupMetadata.OwnerID)
+	}
+
+	return nil
+}
+
+// recordConversationCreated records the creation of a conversation and of the memberships of its initial participants.
+func recordConversationCreated(ctx context.Context, db DBOperator, conversationID uuid.UUID, participantIDs ...uuid.UUID) error {
+	err := recordChange(ctx, db, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityConversation,
+		EntityID:       conversationID,
+		Action:         ChangeActionCreated,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, participantID := range participantIDs {
+		err := recordChange(ctx, db, Change{
+			ConversationID: conversationID,
+			Entity:         ChangeEntityParticipant,
+			EntityID:       participantID,
+			Action:         ChangeActionCreated,
+			UserID:         &participantID,
+		})
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -289,27 +524,33 @@ func (cm *ConversationModel) CreateGroup(ctx context.Context, conversation *Conv
 func (cm *ConversationModel) Get(ctx context.Context, conversationID uuid.UUID, conversationType string) (*Conversation, error) {
 	query := `
 		SELECT
-			c.id, c.created_at, c.updated_at, c.version,
-			gm.owner_id, gm.name
+			c.id, c.type, c.created_at, c.updated_at, c.version,
+			gm.owner_id, gm.name, gm.description, gm.avatar_url, gm.visibility,
+			coalesce(gm.member_count, 0)
 		FROM conversations c
 		LEFT JOIN group_metadata gm ON gm.conversation_id = c.id
-		WHERE c.id = $1 AND c.type = $2
+		WHERE c.id = $1 AND c.type = $2 AND c.deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	var conversation Conversation
-	var groupOwnerID *uuid.UUID
-	var groupName *string
+	var group nullableGroupMetadata
+	var memberCount int
 
 	err := cm.DB.QueryRowContext(ctx, query, conversationID, conversationType).Scan(
 		&conversation.ID,
+		&conversation.Type,
 		&conversation.CreatedAt,
 		&conversation.UpdatedAt,
 		&conversation.Version,
-		&groupOwnerID,
-		&groupName,
+		&group.ownerID,
+		&group.name,
+		&group.description,
+		&group.avatarURL,
+		&group.visibility,
+		&memberCount,
 	)
 
 	if err != nil {
@@ -321,12 +562,486 @@ func (cm *ConversationModel) Get(ctx context.Context, conversationID uuid.UUID,
 		}
 	}
 
-	if groupOwnerID != nil {
-		conversation.GroupMetadata = &GroupMetadata{
-			OwnerID: *groupOwnerID,
-			Name:    *groupName,
-		}
+	if conversation.GroupMetadata = group.metadata(); conversation.GroupMetadata != nil {
+		conversation.GroupMetadata.MemberCount = memberCount
 	}
 
 	return &conversation, nil
 }
+
+// GetMany returns the conversations with the given ids, keyed by id. Missing conversations are left out.
+func (cm *ConversationModel) GetMany(ctx context.Context, conversationIDs []uuid.UUID) (map[uuid.UUID]*Conversation, error) {
+	query := `
+		SELECT
+			c.id, c.type, c.created_at, c.updated_at, c.version,
+			gm.owner_id, gm.name, gm.description, gm.avatar_url, gm.visibility
+		FROM conversations c
+		LEFT JOIN group_metadata gm ON gm.conversation_id = c.id
+		WHERE c.id = ANY($1::uuid[]) AND c.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, query, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := make(map[uuid.UUID]*Conversation)
+
+	for rows.Next() {
+		var conversation Conversation
+		var group nullableGroupMetadata
+
+		err := rows.Scan(
+			&conversation.ID,
+			&conversation.Type,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+			&conversation.Version,
+			&group.ownerID,
+			&group.name,
+			&group.description,
+			&group.avatarURL,
+			&group.visibility,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conversation.GroupMetadata = group.metadata()
+
+		conversations[conversation.ID] = &conversation
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conversations, nil
+}
+
+// Lock locks the conversation until the end of the transaction, serializing membership changes.
+// It must be run in a transaction. ErrNoRecordFound is returned if the conversation does not exist.
+func (cm *ConversationModel) Lock(ctx context.Context, conversationID uuid.UUID) error {
+	// Unlike FOR UPDATE, this doesn't block inserting rows referencing the conversation. New messages still
+	// wait to update its last message, but membership changes are short.
+	query := `SELECT id FROM conversations WHERE id = $1 FOR NO KEY UPDATE`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := cm.DB.QueryRowContext(ctx, query, conversationID).Scan(&conversationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoRecordFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TransferGroupOwnership makes the participant the owner of the group, and the previous owner an admin.
+// It should be run in a transaction. ErrNoRecordFound is returned if the new owner is not a participant.
+func (cm *ConversationModel) TransferGroupOwnership(ctx context.Context, groupID, newOwnerID uuid.UUID) error {
+	query := `
+	UPDATE conversation_participants
+	SET role = 'admin'
+	WHERE conversation_id = $1 AND role = 'owner'
+	RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var previousOwnerID uuid.UUID
+
+	err := cm.DB.QueryRowContext(ctx, query, groupID).Scan(&previousOwnerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	query = `UPDATE conversation_participants SET role = 'owner' WHERE conversation_id = $1 AND user_id = $2`
+
+	result, err := cm.DB.ExecContext(ctx, query, groupID, newOwnerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	query = `UPDATE group_metadata SET owner_id = $1 WHERE conversation_id = $2`
+
+	if _, err := cm.DB.ExecContext(ctx, query, newOwnerID, groupID); err != nil {
+		return err
+	}
+
+	query = `UPDATE conversations SET updated_at = NOW(), version = version + 1 WHERE id = $1`
+
+	if _, err := cm.DB.ExecContext(ctx, query, groupID); err != nil {
+		return err
+	}
+
+	changes := []Change{
+		{ConversationID: groupID, Entity: ChangeEntityConversation, EntityID: groupID, Action: ChangeActionUpdated},
+		{ConversationID: groupID, Entity: ChangeEntityParticipant, EntityID: newOwnerID, Action: ChangeActionUpdated, UserID: &newOwnerID},
+	}
+
+	if previousOwnerID != uuid.Nil {
+		changes = append(changes, Change{ConversationID: groupID, Entity: ChangeEntityParticipant, EntityID: previousOwnerID, Action: ChangeActionUpdated, UserID: &previousOwnerID})
+	}
+
+	for _, change := range changes {
+		if err := recordChange(ctx, cm.DB, change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes the conversation along with everything in it.
+// ErrNoRecordFound is returned if the conversation does not exist.
+func (cm *ConversationModel) Delete(ctx context.Context, conversationID uuid.UUID) error {
+	query := `DELETE FROM conversations WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cm.DB.ExecContext(ctx, query, conversationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return recordChange(ctx, cm.DB, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityConversation,
+		EntityID:       conversationID,
+		Action:         ChangeActionDeleted,
+	})
+}
+
+// MarkDeleted deletes the conversation for all of its participants, who are removed from it right away.
+// The rest of it is left to be purged with PurgeBatch, since large conversations can take long to delete.
+// It should be run in a transaction. ErrNoRecordFound is returned if the conversation does not exist.
+func (cm *ConversationModel) MarkDeleted(ctx context.Context, conversationID uuid.UUID) error {
+	query := `UPDATE conversations SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cm.DB.ExecContext(ctx, query, conversationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	if err := recordParticipantsRemoved(ctx, cm.DB, conversationID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM conversation_participants WHERE conversation_id = $1`
+
+	if _, err := cm.DB.ExecContext(ctx, query, conversationID); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cm.DB, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityConversation,
+		EntityID:       conversationID,
+		Action:         ChangeActionDeleted,
+	})
+}
+
+// PurgeBatch deletes up to batchSize messages of a conversation marked as deleted, and then the conversation
+// along with everything else in it once it has no messages left. It reports whether the conversation is gone.
+func (cm *ConversationModel) PurgeBatch(ctx context.Context, conversationID uuid.UUID, batchSize int) (bool, error) {
+	// The latest messages are deleted first since replies always come after the messages they reply to.
+	query := `
+	DELETE FROM conversation_messages
+	WHERE id IN (
+		SELECT id FROM conversation_messages
+		WHERE conversation_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cm.DB.ExecContext(ctx, query, conversationID, batchSize)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		return false, nil
+	}
+
+	query = `DELETE FROM conversations WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	_, err = cm.DB.ExecContext(ctx, query, conversationID)
+
+	return err == nil, err
+}
+
+// GetAllDeletedIDs returns the ids of the conversations marked as deleted that haven't been purged yet.
+func (cm *ConversationModel) GetAllDeletedIDs(ctx context.Context) ([]uuid.UUID, error) {
+	query := `SELECT id FROM conversations WHERE deleted_at IS NOT NULL ORDER BY deleted_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := cm.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversationIDs := make([]uuid.UUID, 0)
+
+	for rows.Next() {
+		var id uuid.UUID
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		conversationIDs = append(conversationIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conversationIDs, nil
+}
+
+// UpdateGroupMetadata stores the current name, description, avatar and visibility of the group.
+// It should be run in a transaction. ErrEditConflict is returned if the group has been changed since it was read.
+func (cm *ConversationModel) UpdateGroupMetadata(ctx context.Context, group *Conversation) error {
+	query := `
+	UPDATE conversations
+	SET updated_at = NOW(), version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := cm.DB.QueryRowContext(ctx, query, group.ID, group.Version).Scan(&group.UpdatedAt, &group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `UPDATE group_metadata SET name = $1, description = $2, avatar_url = $3, visibility = $4 WHERE conversation_id = $5`
+
+	metadata := group.GroupMetadata
+	args := []any{metadata.Name, metadata.Description, metadata.AvatarURL, metadata.Visibility, group.ID}
+
+	if _, err := cm.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cm.DB, Change{
+		ConversationID: group.ID,
+		Entity:         ChangeEntityConversation,
+		EntityID:       group.ID,
+		Action:         ChangeActionUpdated,
+	})
+}
+
+// GetAllPublicGroups lists the public groups whose name contains search, along with their member counts.
+func (cm *ConversationModel) GetAllPublicGroups(ctx context.Context, search string, f filter.Filters) ([]*Conversation, *filter.PaginationMetadata, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		count(*) OVER(),
+		c.id, c.type, c.created_at, c.updated_at, c.version,
+		gm.owner_id, gm.name, gm.description, gm.avatar_url, gm.visibility, gm.member_count
+	FROM conversations c
+	JOIN group_metadata gm ON gm.conversation_id = c.id
+	WHERE c.type = 'group' AND c.deleted_at IS NULL AND gm.visibility = 'public' AND ($1 = '' OR gm.name ILIKE '%%' || $1 || '%%')
+	ORDER BY %s %s, c.id ASC
+	LIMIT $2 OFFSET $3
+	`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Wildcards are escaped so they are matched literally.
+	search = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search)
+
+	rows, err := cm.DB.QueryContext(ctx, query, search, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	groups := make([]*Conversation, 0)
+
+	for rows.Next() {
+		var (
+			conversation Conversation
+			group        nullableGroupMetadata
+			memberCount  int
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&conversation.ID,
+			&conversation.Type,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+			&conversation.Version,
+			&group.ownerID,
+			&group.name,
+			&group.description,
+			&group.avatarURL,
+			&group.visibility,
+			&memberCount,
+		)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		conversation.GroupMetadata = group.metadata()
+		conversation.GroupMetadata.MemberCount = memberCount
+
+		groups = append(groups, &conversation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return groups, paginationMetadata, nil
+}
+
+// GetGroupSettings returns the settings of the group.
+// ErrNoRecordFound is returned if the group does not exist.
+func (cm *ConversationModel) GetGroupSettings(ctx context.Context, groupID uuid.UUID) (*GroupSettings, error) {
+	query := `
+	SELECT send_messages, send_media, add_members, slow_mode_interval
+	FROM group_metadata
+	WHERE conversation_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var settings GroupSettings
+
+	err := cm.DB.QueryRowContext(ctx, query, groupID).Scan(
+		&settings.SendMessages,
+		&settings.SendMedia,
+		&settings.AddMembers,
+		&settings.SlowModeInterval,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &settings, nil
+}
+
+// UpdateGroupSettings stores the settings of the group.
+// It should be run in a transaction. ErrEditConflict is returned if the group has been changed since it was read.
+func (cm *ConversationModel) UpdateGroupSettings(ctx context.Context, group *Conversation, settings *GroupSettings) error {
+	query := `
+	UPDATE conversations
+	SET updated_at = NOW(), version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := cm.DB.QueryRowContext(ctx, query, group.ID, group.Version).Scan(&group.UpdatedAt, &group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+	UPDATE group_metadata
+	SET send_messages = $1, send_media = $2, add_members = $3, slow_mode_interval = $4
+	WHERE conversation_id = $5
+	`
+
+	args := []any{settings.SendMessages, settings.SendMedia, settings.AddMembers, settings.SlowModeInterval, group.ID}
+
+	if _, err := cm.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cm.DB, Change{
+		ConversationID: group.ID,
+		Entity:         ChangeEntityConversation,
+		EntityID:       group.ID,
+		Action:         ChangeActionUpdated,
+	})
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// ConversationDraft is an unsent message of a user, kept server-side so it's synced across devices.
+// Unlike messages, the content of formatted drafts is stored as is, markup included.
+type ConversationDraft struct {
+	UserID           uuid.UUID  `json:"-"`
+	ConversationID   uuid.UUID  `json:"-"`
+	Content          string     `json:"content"`
+	Format           string     `json:"format"`
+	RepliedMessageID *uuid.UUID `json:"replied_message_id"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type ConversationDraftModel struct {
+	DB DBOperator
+}
+
+func ValidateConversationDraft(v *validator.Validator, draft *ConversationDraft) {
+	v.Check(draft.Content != "", "content", "must be provided")
+	v.Check(utf8.RuneCountInString(draft.Content) <= 4096, "content", "must not be more than 4096 characters long")
+	v.Check(slices.Contains([]string{FormatPlain, FormatMarkdown}, draft.Format), "format", "must be either plain or markdown")
+}
+
+// Upsert saves the draft, replacing the previous draft of the user in the conversation.
+func (cdm *ConversationDraftModel) Upsert(ctx context.Context, draft *ConversationDraft) error {
+	query := `
+	INSERT INTO conversation_drafts (user_id, conversation_id, content, format, replied_message_id)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, conversation_id) DO UPDATE
+	SET
+		content = EXCLUDED.content,
+		format = EXCLUDED.format,
+		replied_message_id = EXCLUDED.replied_message_id,
+		updated_at = NOW()
+	RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{draft.UserID, draft.ConversationID, draft.Content, draft.Format, draft.RepliedMessageID}
+
+	return cdm.DB.QueryRowContext(ctx, query, args...).Scan(&draft.UpdatedAt)
+}
+
+// Delete removes the draft of the user in the conversation, if any.
+func (cdm *ConversationDraftModel) Delete(ctx context.Context, userID, conversationID uuid.UUID) error {
+	query := `DELETE FROM conversation_drafts WHERE user_id = $1 AND conversation_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := cdm.DB.ExecContext(ctx, query, userID, conversationID)
+
+	return err
+}
@@ -0,0 +1,352 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// MaxConversationFolders is how many folders a user can have.
+const MaxConversationFolders = 10
+
+var (
+	ErrFolderLimitReached = errors.New("folder limit reached")
+)
+
+// ConversationFolder groups conversations of a user. Conversations are in a folder if they match any of its rules,
+// which are their type and being unread, or if they were added to it manually.
+type ConversationFolder struct {
+	BaseModel
+	UserID          uuid.UUID   `json:"-"`
+	Name            string      `json:"name"`
+	Position        int         `json:"position"`
+	IncludeTypes    []string    `json:"include_types"`
+	IncludeUnread   bool        `json:"include_unread"`
+	ConversationIDs []uuid.UUID `json:"conversation_ids"`
+}
+
+type ConversationFolderModel struct {
+	DB DBOperator
+}
+
+func ValidateConversationFolder(v *validator.Validator, folder *ConversationFolder) {
+	v.Check(folder.Name != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(folder.Name) <= 64, "name", "must not be more than 64 characters long")
+
+	seen := make(map[string]bool, len(folder.IncludeTypes))
+
+	for _, t := range folder.IncludeTypes {
+		v.Check(validator.PermittedValue(t, ConversationTypePrivate, ConversationTypeGroup, ConversationTypeSelf, ConversationTypeChannel), "include_types", "must only contain private, group, self or channel")
+		v.Check(!seen[t], "include_types", "must not contain duplicate types")
+
+		seen[t] = true
+	}
+}
+
+// recordFolderChange appends a change of the folder to the change log.
+// Folders are in no conversation, so the change is only synced to their owner.
+func recordFolderChange(ctx context.Context, db DBOperator, folder *ConversationFolder, action string) error {
+	return recordChange(ctx, db, Change{
+		Entity:   ChangeEntityFolder,
+		EntityID: folder.ID,
+		Action:   action,
+		UserID:   &folder.UserID,
+	})
+}
+
+// Insert stores the folder after the other folders of the user.
+// It must be run in a transaction. ErrFolderLimitReached is returned if the user already has MaxConversationFolders folders.
+func (cfm *ConversationFolderModel) Insert(ctx context.Context, folder *ConversationFolder) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Concurrent inserts of the user wait for each other, so they can't pass the limit or take the same position.
+	if err := lockUser(ctx, cfm.DB, folder.UserID); err != nil {
+		return err
+	}
+
+	query := `SELECT count(*) FROM conversation_folders WHERE user_id = $1`
+
+	var count int
+
+	if err := cfm.DB.QueryRowContext(ctx, query, folder.UserID).Scan(&count); err != nil {
+		return err
+	}
+
+	if count >= MaxConversationFolders {
+		return ErrFolderLimitReached
+	}
+
+	query = `
+	INSERT INTO conversation_folders (user_id, name, position, include_types, include_unread)
+	SELECT $1, $2, coalesce(max(position) + 1, 0), $3::conversation_type[], $4
+	FROM conversation_folders
+	WHERE user_id = $1
+	RETURNING id, position, created_at, updated_at, version
+	`
+
+	args := []any{folder.UserID, folder.Name, pq.Array(folder.IncludeTypes), folder.IncludeUnread}
+
+	err := cfm.DB.QueryRowContext(ctx, query, args...).Scan(&folder.ID, &folder.Position, &folder.CreatedAt, &folder.UpdatedAt, &folder.Version)
+	if err != nil {
+		return err
+	}
+
+	folder.ConversationIDs = []uuid.UUID{}
+
+	return recordFolderChange(ctx, cfm.DB, folder, ChangeActionCreated)
+}
+
+// getAll returns the folders of the user matching the condition, which can use the parameters after the user id, in order.
+func (cfm *ConversationFolderModel) getAll(ctx context.Context, userID uuid.UUID, condition string, args ...any) ([]*ConversationFolder, error) {
+	query := `
+	SELECT
+		f.id, f.name, f.position, f.include_types, f.include_unread, f.created_at, f.updated_at, f.version,
+		coalesce(array_agg(fc.conversation_id ORDER BY fc.created_at) FILTER (WHERE fc.conversation_id IS NOT NULL), '{}')
+	FROM conversation_folders f
+	LEFT JOIN conversation_folder_conversations fc ON fc.folder_id = f.id
+	WHERE f.user_id = $1 AND ` + condition + `
+	GROUP BY f.id
+	ORDER BY f.position, f.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := cfm.DB.QueryContext(ctx, query, append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	folders := make([]*ConversationFolder, 0)
+
+	for rows.Next() {
+		folder := ConversationFolder{UserID: userID}
+
+		var conversationIDs []string
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.Name,
+			&folder.Position,
+			pq.Array(&folder.IncludeTypes),
+			&folder.IncludeUnread,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+			&folder.Version,
+			pq.Array(&conversationIDs),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		folder.ConversationIDs = make([]uuid.UUID, 0, len(conversationIDs))
+
+		for _, id := range conversationIDs {
+			conversationID, err := uuid.Parse(id)
+			if err != nil {
+				return nil, err
+			}
+
+			folder.ConversationIDs = append(folder.ConversationIDs, conversationID)
+		}
+
+		folders = append(folders, &folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// Get returns the folder of the user. ErrNoRecordFound is returned if the user has no such folder.
+func (cfm *ConversationFolderModel) Get(ctx context.Context, folderID, userID uuid.UUID) (*ConversationFolder, error) {
+	folders, err := cfm.getAll(ctx, userID, "f.id = $2", folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(folders) == 0 {
+		return nil, ErrNoRecordFound
+	}
+
+	return folders[0], nil
+}
+
+// GetAllForUser lists the folders of the user in order.
+func (cfm *ConversationFolderModel) GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*ConversationFolder, error) {
+	return cfm.getAll(ctx, userID, "true")
+}
+
+// GetMany returns the folders of the user with the given ids, keyed by id. Missing folders are left out.
+func (cfm *ConversationFolderModel) GetMany(ctx context.Context, userID uuid.UUID, folderIDs []uuid.UUID) (map[uuid.UUID]*ConversationFolder, error) {
+	folders, err := cfm.getAll(ctx, userID, "f.id = ANY($2::uuid[])", pq.Array(folderIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uuid.UUID]*ConversationFolder, len(folders))
+
+	for _, folder := range folders {
+		result[folder.ID] = folder
+	}
+
+	return result, nil
+}
+
+// Update saves the name and rules of the folder.
+// ErrEditConflict is returned if the folder was changed or deleted since it was read.
+func (cfm *ConversationFolderModel) Update(ctx context.Context, folder *ConversationFolder) error {
+	query := `
+	UPDATE conversation_folders
+	SET name = $1, include_types = $2::conversation_type[], include_unread = $3, updated_at = NOW(), version = version + 1
+	WHERE id = $4 AND user_id = $5 AND version = $6
+	RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{folder.Name, pq.Array(folder.IncludeTypes), folder.IncludeUnread, folder.ID, folder.UserID, folder.Version}
+
+	err := cfm.DB.QueryRowContext(ctx, query, args...).Scan(&folder.UpdatedAt, &folder.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return recordFolderChange(ctx, cfm.DB, folder, ChangeActionUpdated)
+}
+
+// Delete removes the folder of the user. The conversations in it are left as they are.
+// ErrNoRecordFound is returned if the user has no such folder.
+func (cfm *ConversationFolderModel) Delete(ctx context.Context, folderID, userID uuid.UUID) error {
+	query := `DELETE FROM conversation_folders WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cfm.DB.ExecContext(ctx, query, folderID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return recordFolderChange(ctx, cfm.DB, &ConversationFolder{BaseModel: BaseModel{ID: folderID}, UserID: userID}, ChangeActionDeleted)
+}
+
+// Reorder moves the folders of the user to the positions of their ids, which must be the ids of all of them.
+// It should be run in a transaction.
+func (cfm *ConversationFolderModel) Reorder(ctx context.Context, userID uuid.UUID, folderIDs []uuid.UUID) error {
+	query := `
+	UPDATE conversation_folders f
+	SET position = o.position - 1, updated_at = NOW(), version = f.version + 1
+	FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, position)
+	WHERE f.id = o.id AND f.user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := cfm.DB.ExecContext(ctx, query, userID, pq.Array(folderIDs)); err != nil {
+		return err
+	}
+
+	for _, folderID := range folderIDs {
+		err := recordFolderChange(ctx, cfm.DB, &ConversationFolder{BaseModel: BaseModel{ID: folderID}, UserID: userID}, ChangeActionUpdated)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddConversation adds the conversation to the folder of the user manually. Adding it again does nothing.
+// ErrConversationDoesNotExist is returned if the user doesn't participate in the conversation.
+func (cfm *ConversationFolderModel) AddConversation(ctx context.Context, folder *ConversationFolder, conversationID uuid.UUID) error {
+	query := `
+	INSERT INTO conversation_folder_conversations (folder_id, user_id, conversation_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (folder_id, conversation_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cfm.DB.ExecContext(ctx, query, folder.ID, folder.UserID, conversationID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `pq: insert or update on table "conversation_folder_conversations" violates foreign key constraint "conversation_folder_conversations_conversation_id_user_id_fkey"`):
+			return ErrConversationDoesNotExist
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	folder.ConversationIDs = append(folder.ConversationIDs, conversationID)
+
+	return recordFolderChange(ctx, cfm.DB, folder, ChangeActionUpdated)
+}
+
+// RemoveConversation removes the conversation added to the folder manually.
+// The conversation may still be in the folder because of its rules.
+// ErrNoRecordFound is returned if the conversation wasn't added to the folder.
+func (cfm *ConversationFolderModel) RemoveConversation(ctx context.Context, folder *ConversationFolder, conversationID uuid.UUID) error {
+	query := `DELETE FROM conversation_folder_conversations WHERE folder_id = $1 AND conversation_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cfm.DB.ExecContext(ctx, query, folder.ID, conversationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	folder.ConversationIDs = slices.DeleteFunc(folder.ConversationIDs, func(id uuid.UUID) bool { return id == conversationID })
+
+	return recordFolderChange(ctx, cfm.DB, folder, ChangeActionUpdated)
+}
@@ -2,35 +2,64 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/markup"
 	"github.com/thisisjab/gchat-go/internal/validator"
 )
 
 const (
-	TypeTextMessage  = "text"
-	TypeImageMessage = "image"
-	TypeVideoMessage = "video"
-	TypeAudioMessage = "audio"
-	TypeFileMessage  = "file"
+	TypeTextMessage     = "text"
+	TypeImageMessage    = "image"
+	TypeVideoMessage    = "video"
+	TypeAudioMessage    = "audio"
+	TypeFileMessage     = "file"
+	TypePollMessage     = "poll"
+	TypeLocationMessage = "location"
+	TypeContactMessage  = "contact"
+	TypeSystemMessage   = "system"
+)
+
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
 )
 
 type ConversationMessageModel struct {
 	DB DBOperator
 }
 
+var (
+	ErrConversationMessageDuplicate = errors.New("duplicate message")
+	ErrContentTooLong               = errors.New("content is too long")
+)
+
 type ConversationMessage struct {
 	BaseModel
-	ConversationID   uuid.UUID  `json:"-"`
-	SenderID         uuid.UUID  `json:"sender_id,omitempty"`
-	Content          string     `json:"content"`
-	RepliedMessageID *uuid.UUID `json:"-"`
-	Type             string     `json:"type"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
+	ConversationID   uuid.UUID       `json:"-"`
+	SenderID         *uuid.UUID      `json:"sender_id,omitempty"` // Nil for system messages, whose actor is in their event.
+	Content          string          `json:"content"`
+	RepliedMessageID *uuid.UUID      `json:"-"`
+	ClientMessageID  *string         `json:"client_message_id,omitempty"` // Client-generated id used to deduplicate retries.
+	Type             string          `json:"type"`
+	Format           string          `json:"format"`
+	Entities         []markup.Entity `json:"entities,omitempty"` // Formatting of content, which is always stored as plain text.
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	Poll             *Poll           `json:"poll,omitempty"`
+	Location         *Location       `json:"location,omitempty"`
+	Contact          *Contact        `json:"contact,omitempty"`
+	Event            *SystemEvent    `json:"event,omitempty"`        // Only set for system messages.
+	LinkPreview      *LinkPreview    `json:"link_preview,omitempty"` // Attached asynchronously after the message is created.
 	// TODO: add attachment
 }
 
@@ -42,31 +71,99 @@ type ConversationMessageWithRepliedMessage struct {
 type ConversationMessageWithRepliedMessageAndSender struct {
 	ConversationMessage
 	// Since sender id is omitted when empty, don't need exclude here; it's already excluded in the query.
-	Sender         User                 `json:"sender"`
+	// Sender is nil for system messages, which aren't sent by any user.
+	Sender         *User                `json:"sender"`
 	RepliedMessage *ConversationMessage `json:"replied_message"`
 }
 
-func ValidateConversationMessage(v *validator.Validator, cm *ConversationMessage) {
+// maxMarkupRatio bounds how much longer formatted content can be than the plain text it's parsed into,
+// as markup such as the urls of links isn't counted towards the length of messages.
+const maxMarkupRatio = 4
+
+// ParseFormat normalizes formatted content into plain text and entities.
+// It's a no-op for messages that are not formatted.
+// Content with more markup than a message of maxContentLength characters could hold is rejected before parsing.
+func (cm *ConversationMessage) ParseFormat(maxContentLength int) error {
+	if cm.Format != FormatMarkdown {
+		return nil
+	}
+
+	if utf8.RuneCountInString(cm.Content) > maxContentLength*maxMarkupRatio {
+		return ErrContentTooLong
+	}
+
+	text, entities, err := markup.Parse(cm.Content)
+	if err != nil {
+		return err
+	}
+
+	cm.Content = text
+	cm.Entities = entities
+
+	return nil
+}
+
+// ValidateConversationMessage validates a message whose content is at most maxContentLength characters long.
+// Formatted messages must be parsed with ParseFormat beforehand so markup is not counted.
+func ValidateConversationMessage(v *validator.Validator, cm *ConversationMessage, maxContentLength int) {
 	v.Check(cm.ConversationID != uuid.Nil, "conversation_id", "must be provided")
-	v.Check(cm.SenderID != uuid.Nil, "sender_id", "must be provided")
+	v.Check(cm.SenderID != nil && *cm.SenderID != uuid.Nil, "sender_id", "must be provided")
 
 	v.Check(cm.Type != "", "type", "must be provided")
-	v.Check(slices.Contains([]string{TypeTextMessage, TypeImageMessage, TypeVideoMessage, TypeAudioMessage, TypeFileMessage}, cm.Type), "type", "must be one of text, image, video, audio, or file")
+	// System messages are only ever inserted by the server, see NewSystemMessage.
+	v.Check(cm.Type != TypeSystemMessage, "type", "must not be system")
+	v.Check(slices.Contains([]string{TypeTextMessage, TypeImageMessage, TypeVideoMessage, TypeAudioMessage, TypeFileMessage, TypePollMessage, TypeLocationMessage, TypeContactMessage}, cm.Type), "type", "must be one of text, image, video, audio, file, poll, location, or contact")
+
+	// Location and contact messages carry their data in a structured payload, so content is an optional caption.
+	if cm.Type != TypeLocationMessage && cm.Type != TypeContactMessage {
+		v.Check(cm.Content != "", "content", "must be provided")
+	}
+	v.Check(utf8.RuneCountInString(cm.Content) <= maxContentLength, "content", fmt.Sprintf("must not be more than %d characters long", maxContentLength))
+
+	v.Check(slices.Contains([]string{FormatPlain, FormatMarkdown}, cm.Format), "format", "must be either plain or markdown")
+
+	v.Check(cm.ClientMessageID == nil || *cm.ClientMessageID != "", "client_message_id", "must not be empty")
+	v.Check(cm.ClientMessageID == nil || len(*cm.ClientMessageID) <= 100, "client_message_id", "must not be more than 100 bytes long")
+
+	if cm.Type == TypePollMessage {
+		if v.Check(cm.Poll != nil, "poll", "must be provided"); cm.Poll != nil {
+			ValidatePoll(v, cm.Poll)
+		}
+	} else {
+		v.Check(cm.Poll == nil, "poll", "must only be provided for poll messages")
+	}
+
+	if cm.Type == TypeLocationMessage {
+		if v.Check(cm.Location != nil, "location", "must be provided"); cm.Location != nil {
+			ValidateLocation(v, cm.Location)
+		}
+	} else {
+		v.Check(cm.Location == nil, "location", "must only be provided for location messages")
+	}
 
-	v.Check(cm.Content != "", "content", "must be provided")
-	v.Check(len(cm.Content) <= 500, "content", "must not be more than 500 bytes long")
+	if cm.Type == TypeContactMessage {
+		if v.Check(cm.Contact != nil, "contact", "must be provided"); cm.Contact != nil {
+			ValidateContact(v, cm.Contact)
+		}
+	} else {
+		v.Check(cm.Contact == nil, "contact", "must only be provided for contact messages")
+	}
 }
 
-func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conversationID uuid.UUID, f filter.Filters) ([]*ConversationMessageWithRepliedMessage, *filter.PaginationMetadata, error) {
+// GetAllForPrivate returns the messages of a private conversation.
+// viewerID is used to include the requesting user's own votes in polls and to leave out the history they cleared.
+func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conversationID, viewerID uuid.UUID, f filter.Filters) ([]*ConversationMessageWithRepliedMessage, *filter.PaginationMetadata, error) {
 	query := `
 	SELECT
 		count(*) OVER(),
-		cm.id, cm.sender_id, cm.type, cm.content, cm.created_at, cm.updated_at,
+		cm.id, cm.sender_id, cm.type, cm.format, cm.content, cm.payload, cm.created_at, cm.updated_at,
 		r.id, r.sender_id, r.type, r.content, r.created_at, r.updated_at
 	FROM conversation_messages cm
 	LEFT JOIN conversation_messages r
 	ON cm.replied_message_id = r.id
-	WHERE cm.conversation_id = $1
+	WHERE cm.conversation_id = $1 AND cm.created_at > coalesce(
+		(SELECT p.cleared_at FROM conversation_preferences p WHERE p.conversation_id = $1 AND p.user_id = $4), '-infinity'
+	)
 	ORDER BY cm.created_at DESC, cm.id DESC
 	LIMIT $2 OFFSET $3
 	`
@@ -74,7 +171,7 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := cmm.DB.QueryContext(ctx, query, conversationID, f.Limit(), f.Offset())
+	rows, err := cmm.DB.QueryContext(ctx, query, conversationID, f.Limit(), f.Offset(), viewerID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -94,6 +191,8 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 		}
 
 		var (
+			payload []byte
+
 			repliedMessageID        *uuid.UUID
 			repliedMessageSenderID  *uuid.UUID
 			repliedMessageType      *string
@@ -107,7 +206,9 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 			&m.ID,
 			&m.SenderID,
 			&m.Type,
+			&m.Format,
 			&m.Content,
+			&payload,
 			&m.CreatedAt,
 			&m.UpdatedAt,
 			&repliedMessageID,
@@ -122,14 +223,19 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 			return nil, nil, err
 		}
 
+		if err := m.setPayload(payload); err != nil {
+			return nil, nil, err
+		}
+
 		if repliedMessageID != nil {
 			m.RepliedMessage = &ConversationMessage{
 				BaseModel: BaseModel{
 					ID: *repliedMessageID,
 				},
 				ConversationID: conversationID,
-				SenderID:       *repliedMessageSenderID,
+				SenderID:       repliedMessageSenderID,
 				Type:           *repliedMessageType,
+				Format:         FormatPlain,
 				Content:        *repliedMessageContent,
 				CreatedAt:      *repliedMessageCreatedAt,
 				UpdatedAt:      *repliedMessageUpdatedAt,
@@ -143,6 +249,18 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 		return nil, nil, err
 	}
 
+	if err := attachPolls(ctx, cmm.DB, viewerID, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachContactUsers(ctx, cmm.DB, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachLinkPreviews(ctx, cmm.DB, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
 	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
 	if err != nil {
 		return nil, nil, err
@@ -151,17 +269,21 @@ func (cmm *ConversationMessageModel) GetAllForPrivate(ctx context.Context, conve
 	return messages, paginationMetadata, nil
 }
 
-func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, conversationID uuid.UUID, f filter.Filters) ([]*ConversationMessageWithRepliedMessageAndSender, *filter.PaginationMetadata, error) {
+// GetAllForGroup returns the messages of a group conversation along with their senders.
+// viewerID is used to include the requesting user's own votes in polls and to leave out the history they cleared.
+func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, conversationID, viewerID uuid.UUID, f filter.Filters) ([]*ConversationMessageWithRepliedMessageAndSender, *filter.PaginationMetadata, error) {
 	query := `
 	SELECT
 		count(*) OVER(),
-		m.id, m.type, m.content, m.created_at, m.updated_at,
+		m.id, m.type, m.format, m.content, m.payload, m.created_at, m.updated_at,
 		u.id, u.username, u.email, u.bio, u.is_active,
 		r.id, r.sender_id, r.type, r.content, r.created_at, r.updated_at
 	FROM conversation_messages m
-	JOIN users u ON u.id = m.sender_id
+	LEFT JOIN users u ON u.id = m.sender_id
 	LEFT JOIN conversation_messages r ON m.replied_message_id = r.id
-	WHERE m.conversation_id = $1
+	WHERE m.conversation_id = $1 AND m.created_at > coalesce(
+		(SELECT p.cleared_at FROM conversation_preferences p WHERE p.conversation_id = $1 AND p.user_id = $4), '-infinity'
+	)
 	ORDER BY m.created_at DESC, m.id ASC
 	LIMIT $2 OFFSET $3
 	`
@@ -169,7 +291,7 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := cmm.DB.QueryContext(ctx, query, conversationID, f.Limit(), f.Offset())
+	rows, err := cmm.DB.QueryContext(ctx, query, conversationID, f.Limit(), f.Offset(), viewerID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -189,6 +311,15 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 		}
 
 		var (
+			payload []byte
+
+			// Sender, which system messages don't have
+			senderID       *uuid.UUID
+			senderUsername *string
+			senderEmail    *string
+			senderBio      *string
+			senderIsActive *bool
+
 			repliedMessageID        *uuid.UUID
 			repliedMessageSenderID  *uuid.UUID
 			repliedMessageType      *string
@@ -201,14 +332,16 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 			&totalRecords,
 			&m.ID,
 			&m.Type,
+			&m.Format,
 			&m.Content,
+			&payload,
 			&m.CreatedAt,
 			&m.UpdatedAt,
-			&m.Sender.ID,
-			&m.Sender.Username,
-			&m.Sender.Email,
-			&m.Sender.Bio,
-			&m.Sender.IsActive,
+			&senderID,
+			&senderUsername,
+			&senderEmail,
+			&senderBio,
+			&senderIsActive,
 			&repliedMessageID,
 			&repliedMessageSenderID,
 			&repliedMessageType,
@@ -221,14 +354,29 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 			return nil, nil, err
 		}
 
+		if err := m.setPayload(payload); err != nil {
+			return nil, nil, err
+		}
+
+		if senderID != nil {
+			m.Sender = &User{
+				BaseModel: BaseModel{ID: *senderID},
+				Username:  *senderUsername,
+				Email:     *senderEmail,
+				Bio:       senderBio,
+				IsActive:  *senderIsActive,
+			}
+		}
+
 		if repliedMessageID != nil {
 			m.RepliedMessage = &ConversationMessage{
 				BaseModel: BaseModel{
 					ID: *repliedMessageID,
 				},
 				ConversationID: conversationID,
-				SenderID:       *repliedMessageSenderID,
+				SenderID:       repliedMessageSenderID,
 				Type:           *repliedMessageType,
+				Format:         FormatPlain,
 				Content:        *repliedMessageContent,
 				CreatedAt:      *repliedMessageCreatedAt,
 				UpdatedAt:      *repliedMessageUpdatedAt,
@@ -242,6 +390,18 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 		return nil, nil, err
 	}
 
+	if err := attachPolls(ctx, cmm.DB, viewerID, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachContactUsers(ctx, cmm.DB, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachLinkPreviews(ctx, cmm.DB, messagePointers(messages)...); err != nil {
+		return nil, nil, err
+	}
+
 	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
 	if err != nil {
 		return nil, nil, err
@@ -250,19 +410,297 @@ func (cmm *ConversationMessageModel) GetAllForGroup(ctx context.Context, convers
 	return messages, paginationMetadata, nil
 }
 
+// Insert stores the message along with its poll or structured payload, if any, and makes it the latest message of its conversation.
+// Messages should be inserted in a transaction which locked the conversation first with ConversationModel.Lock,
+// so transactions inserting messages and participants all take their locks in the same order.
+// ErrConversationMessageDuplicate is returned if the sender already sent a message with the same client message id.
 func (cmm *ConversationMessageModel) Insert(ctx context.Context, message *ConversationMessage) error {
 	query := `
-	INSERT INTO conversation_messages (conversation_id, sender_id, type, content, replied_message_id)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO conversation_messages (conversation_id, sender_id, type, format, content, payload, replied_message_id, client_message_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	RETURNING id, created_at, updated_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	args := []any{message.ConversationID, message.SenderID, message.Type, message.Content, message.RepliedMessageID}
+	payload, err := message.payload()
+	if err != nil {
+		return err
+	}
+
+	args := []any{message.ConversationID, message.SenderID, message.Type, message.Format, message.Content, payload, message.RepliedMessageID, message.ClientMessageID}
+
+	err = cmm.DB.QueryRowContext(ctx, query, args...).Scan(&message.ID, &message.CreatedAt, &message.UpdatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `pq: duplicate key value violates unique constraint "conversation_messages_sender_id_client_message_id_key"`):
+			return ErrConversationMessageDuplicate
+		default:
+			return err
+		}
+	}
+
+	if message.Poll != nil {
+		if err := insertPoll(ctx, cmm.DB, message.ID, message.Poll); err != nil {
+			return err
+		}
+	}
+
+	// Conversations point to their latest message so listing them doesn't have to look it up.
+	query = `UPDATE conversations SET last_message_id = $1 WHERE id = $2`
+
+	if _, err := cmm.DB.ExecContext(ctx, query, message.ID, message.ConversationID); err != nil {
+		return err
+	}
+
+	// Senders have read their own messages, if they track which messages they read.
+	if message.SenderID != nil {
+		query = `
+		UPDATE conversation_preferences
+		SET last_read_message_id = $1
+		WHERE conversation_id = $2 AND user_id = $3 AND last_read_message_id IS NOT NULL
+		`
+
+		if _, err := cmm.DB.ExecContext(ctx, query, message.ID, message.ConversationID, message.SenderID); err != nil {
+			return err
+		}
+	}
+
+	return recordChange(ctx, cmm.DB, Change{
+		ConversationID: message.ConversationID,
+		Entity:         ChangeEntityMessage,
+		EntityID:       message.ID,
+		Action:         ChangeActionCreated,
+	})
+}
+
+// GetForParticipant returns a message only if userID is a participant of the message's conversation
+// and didn't clear it from their history. ErrNoRecordFound is returned otherwise so non-participants
+// can't tell whether the message exists.
+func (cmm *ConversationMessageModel) GetForParticipant(ctx context.Context, messageID, userID uuid.UUID) (*ConversationMessage, error) {
+	query := `
+	SELECT m.id, m.conversation_id, m.sender_id, m.client_message_id, m.type, m.format, m.content, m.payload, m.replied_message_id, m.created_at, m.updated_at, m.version
+	FROM conversation_messages m
+	JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id
+	WHERE m.id = $1 AND cp.user_id = $2 AND m.created_at > coalesce(
+		(SELECT p.cleared_at FROM conversation_preferences p WHERE p.conversation_id = m.conversation_id AND p.user_id = $2), '-infinity'
+	)
+	`
+
+	return cmm.get(ctx, userID, query, messageID, userID)
+}
+
+// GetMany returns the messages with the given ids as seen by viewerID, keyed by id.
+// Missing messages and messages viewerID cleared from their history are left out.
+func (cmm *ConversationMessageModel) GetMany(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]*ConversationMessage, error) {
+	query := `
+	SELECT m.id, m.conversation_id, m.sender_id, m.client_message_id, m.type, m.format, m.content, m.payload, m.replied_message_id, m.created_at, m.updated_at, m.version
+	FROM conversation_messages m
+	WHERE m.id = ANY($1::uuid[]) AND m.created_at > coalesce(
+		(SELECT p.cleared_at FROM conversation_preferences p WHERE p.conversation_id = m.conversation_id AND p.user_id = $2), '-infinity'
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := cmm.DB.QueryContext(ctx, query, pq.Array(messageIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	messages := make([]*ConversationMessage, 0, len(messageIDs))
+
+	for rows.Next() {
+		var (
+			message ConversationMessage
+			payload []byte
+		)
+
+		err := rows.Scan(
+			&message.ID,
+			&message.ConversationID,
+			&message.SenderID,
+			&message.ClientMessageID,
+			&message.Type,
+			&message.Format,
+			&message.Content,
+			&payload,
+			&message.RepliedMessageID,
+			&message.CreatedAt,
+			&message.UpdatedAt,
+			&message.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := message.setPayload(payload); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := attachPolls(ctx, cmm.DB, viewerID, messages...); err != nil {
+		return nil, err
+	}
+
+	if err := attachContactUsers(ctx, cmm.DB, messages...); err != nil {
+		return nil, err
+	}
+
+	if err := attachLinkPreviews(ctx, cmm.DB, messages...); err != nil {
+		return nil, err
+	}
+
+	result := make(map[uuid.UUID]*ConversationMessage, len(messages))
+
+	for _, m := range messages {
+		result[m.ID] = m
+	}
+
+	return result, nil
+}
+
+// GetByClientMessageID returns the message the sender sent with the given client message id.
+func (cmm *ConversationMessageModel) GetByClientMessageID(ctx context.Context, senderID uuid.UUID, clientMessageID string) (*ConversationMessage, error) {
+	query := `
+	SELECT m.id, m.conversation_id, m.sender_id, m.client_message_id, m.type, m.format, m.content, m.payload, m.replied_message_id, m.created_at, m.updated_at, m.version
+	FROM conversation_messages m
+	WHERE m.sender_id = $1 AND m.client_message_id = $2
+	`
+
+	return cmm.get(ctx, senderID, query, senderID, clientMessageID)
+}
+
+// get scans a single message selected by query, along with its poll (as seen by viewerID), shared contact and link preview.
+func (cmm *ConversationMessageModel) get(ctx context.Context, viewerID uuid.UUID, query string, args ...any) (*ConversationMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		message ConversationMessage
+		payload []byte
+	)
+
+	err := cmm.DB.QueryRowContext(ctx, query, args...).Scan(
+		&message.ID,
+		&message.ConversationID,
+		&message.SenderID,
+		&message.ClientMessageID,
+		&message.Type,
+		&message.Format,
+		&message.Content,
+		&payload,
+		&message.RepliedMessageID,
+		&message.CreatedAt,
+		&message.UpdatedAt,
+		&message.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := message.setPayload(payload); err != nil {
+		return nil, err
+	}
 
-	return cmm.DB.QueryRowContext(ctx, query, args...).Scan(&message.ID, &message.CreatedAt, &message.UpdatedAt)
+	if err := attachPolls(ctx, cmm.DB, viewerID, &message); err != nil {
+		return nil, err
+	}
+
+	if err := attachContactUsers(ctx, cmm.DB, &message); err != nil {
+		return nil, err
+	}
+
+	if err := attachLinkPreviews(ctx, cmm.DB, &message); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// UpdatePayload stores the current structured payload of the message.
+// ErrEditConflict is returned if the message has been changed since it was read.
+func (cmm *ConversationMessageModel) UpdatePayload(ctx context.Context, message *ConversationMessage) error {
+	query := `
+	UPDATE conversation_messages
+	SET payload = $1, updated_at = NOW(), version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	payload, err := message.payload()
+	if err != nil {
+		return err
+	}
+
+	err = cmm.DB.QueryRowContext(ctx, query, payload, message.ID, message.Version).Scan(&message.UpdatedAt, &message.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return recordMessageChange(ctx, cmm.DB, message.ID, ChangeActionUpdated)
+}
+
+// attachPolls loads the polls of the given poll messages and attaches them.
+func attachPolls(ctx context.Context, db DBOperator, viewerID uuid.UUID, messages ...*ConversationMessage) error {
+	messageIDs := make([]uuid.UUID, 0)
+
+	for _, m := range messages {
+		if m.Type == TypePollMessage {
+			messageIDs = append(messageIDs, m.ID)
+		}
+	}
+
+	polls, err := getPollsForMessages(ctx, db, messageIDs, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		m.Poll = polls[m.ID]
+	}
+
+	return nil
+}
+
+// messagePointers returns pointers to the messages embedded in list items.
+func messagePointers[T interface{ message() *ConversationMessage }](items []T) []*ConversationMessage {
+	messages := make([]*ConversationMessage, 0, len(items))
+
+	for _, item := range items {
+		messages = append(messages, item.message())
+	}
+
+	return messages
+}
+
+func (cm *ConversationMessage) message() *ConversationMessage {
+	return cm
 }
 
 func (cmm *ConversationMessageModel) BelongsToConversation(ctx context.Context, messageID, conversationID uuid.UUID, conversationType string) (bool, error) {
@@ -295,3 +733,32 @@ func (cmm *ConversationMessageModel) BelongsToConversation(ctx context.Context,
 
 	return exists, nil
 }
+
+// GetLastSentAt returns when the user last sent a message to the conversation, not counting system messages.
+// ErrNoRecordFound is returned if the user hasn't sent any.
+func (cmm *ConversationMessageModel) GetLastSentAt(ctx context.Context, conversationID, senderID uuid.UUID) (time.Time, error) {
+	query := `
+	SELECT created_at
+	FROM conversation_messages
+	WHERE conversation_id = $1 AND sender_id = $2 AND type <> 'system'
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var sentAt time.Time
+
+	err := cmm.DB.QueryRowContext(ctx, query, conversationID, senderID).Scan(&sentAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrNoRecordFound
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return sentAt, nil
+}
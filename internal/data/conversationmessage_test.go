@@ -0,0 +1,59 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	const maxContentLength = 10
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    string
+		err     error
+	}{
+		{
+			name:    "plain content is left as is",
+			format:  FormatPlain,
+			content: "**" + strings.Repeat("x", maxContentLength*maxMarkupRatio) + "**",
+			want:    "**" + strings.Repeat("x", maxContentLength*maxMarkupRatio) + "**",
+		},
+		{
+			name:    "markup within the ratio is parsed",
+			format:  FormatMarkdown,
+			content: strings.Repeat("**x**", maxContentLength*maxMarkupRatio/5),
+			want:    strings.Repeat("x", maxContentLength*maxMarkupRatio/5),
+		},
+		{
+			name:    "runes are counted rather than bytes",
+			format:  FormatMarkdown,
+			content: strings.Repeat("é", maxContentLength*maxMarkupRatio),
+			want:    strings.Repeat("é", maxContentLength*maxMarkupRatio),
+		},
+		{
+			name:    "markup beyond the ratio is rejected before parsing",
+			format:  FormatMarkdown,
+			content: strings.Repeat("[", maxContentLength*maxMarkupRatio+1),
+			err:     ErrContentTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := &ConversationMessage{Format: tt.format, Content: tt.content}
+
+			err := cm.ParseFormat(maxContentLength)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if tt.err == nil && cm.Content != tt.want {
+				t.Errorf("got content %q, want %q", cm.Content, tt.want)
+			}
+		})
+	}
+}
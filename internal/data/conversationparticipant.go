@@ -2,25 +2,114 @@ package data
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/filter"
 )
 
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Permission is something a group participant may be allowed to do, depending on their role.
+type Permission string
+
+const (
+	PermissionAddMembers           Permission = "add_members"
+	PermissionRemoveMembers        Permission = "remove_members"
+	PermissionEditGroupInfo        Permission = "edit_group_info"
+	PermissionPinMessages          Permission = "pin_messages"
+	PermissionDeleteOthersMessages Permission = "delete_others_messages"
+	PermissionManageAdmins         Permission = "manage_admins"
+	PermissionTransferOwnership    Permission = "transfer_ownership"
+	PermissionManageInvites        Permission = "manage_invites"
+	PermissionChangeVisibility     Permission = "change_visibility"
+	PermissionPostToChannel        Permission = "post_to_channel"
+	PermissionViewSubscribers      Permission = "view_subscribers"
+	PermissionChangeSettings       Permission = "change_settings"
+	PermissionRestrictMembers      Permission = "restrict_members"
+	PermissionDeleteGroup          Permission = "delete_group"
+)
+
+// rolePermissions is the permission matrix of group roles.
+var rolePermissions = map[string][]Permission{
+	RoleOwner: {
+		PermissionAddMembers,
+		PermissionRemoveMembers,
+		PermissionEditGroupInfo,
+		PermissionPinMessages,
+		PermissionDeleteOthersMessages,
+		PermissionManageAdmins,
+		PermissionTransferOwnership,
+		PermissionManageInvites,
+		PermissionChangeVisibility,
+		PermissionPostToChannel,
+		PermissionViewSubscribers,
+		PermissionChangeSettings,
+		PermissionRestrictMembers,
+		PermissionDeleteGroup,
+	},
+	RoleAdmin: {
+		PermissionAddMembers,
+		PermissionRemoveMembers,
+		PermissionEditGroupInfo,
+		PermissionPinMessages,
+		PermissionDeleteOthersMessages,
+		PermissionPostToChannel,
+		PermissionViewSubscribers,
+		PermissionChangeSettings,
+		PermissionRestrictMembers,
+	},
+	RoleMember: {},
+}
+
+// roleRanks orders roles so participants can only act on participants of a lower rank.
+var roleRanks = map[string]int{
+	RoleOwner:  3,
+	RoleAdmin:  2,
+	RoleMember: 1,
+}
+
+// RoleOutranks reports whether the role ranks higher than the other role.
+func RoleOutranks(role, other string) bool {
+	return roleRanks[role] > roleRanks[other]
+}
+
+// RoleHasPermission reports whether participants with the given role have the permission.
+func RoleHasPermission(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
 type ConversationParticipant struct {
 	ConversationID uuid.UUID
 	UserID         uuid.UUID
+	Role           string
 	CreatedAt      time.Time
 }
 
+// GroupParticipant is a participant of a group as listed to other participants.
+type GroupParticipant struct {
+	User     *User     `json:"user"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
 type ConversationParticipantModel struct {
 	DB DBOperator
 }
 
 var (
 	ErrConversationParticipantDuplicate = errors.New("duplicate participant")
+	ErrConversationParticipantBanned    = errors.New("banned participant")
+	ErrGroupFull                        = errors.New("group is full")
 )
 
 func (cpm *ConversationParticipantModel) Exists(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID, conversationType string) (bool, error) {
@@ -54,15 +143,26 @@ func (cpm *ConversationParticipantModel) Exists(ctx context.Context, userID uuid
 	return exists, nil
 }
 
-func (cp *ConversationParticipantModel) AddParticipant(ctx context.Context, conversationID, userID *uuid.UUID) error {
+// AddParticipant adds the user to the group, which can have at most maxMembers participants.
+// It should be run in a transaction, which must be rolled back on error, after locking the group with ConversationModel.Lock.
+// ErrConversationParticipantBanned is returned if the user is banned from it, however they are being added,
+// and ErrGroupFull if the group already has maxMembers participants.
+func (cp *ConversationParticipantModel) AddParticipant(ctx context.Context, conversationID, userID *uuid.UUID, maxMembers int) error {
 	query := `
-		INSERT INTO conversation_participants(conversation_id, user_id) VALUES ($1, $2)
+		INSERT INTO conversation_participants(conversation_id, user_id)
+		SELECT $1::uuid, $2::uuid
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM group_restrictions gr
+			WHERE gr.conversation_id = $1 AND gr.user_id = $2 AND gr.type = 'ban'
+				AND (gr.expires_at IS NULL OR gr.expires_at > NOW())
+		)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	_, err := cp.DB.ExecContext(ctx, query, conversationID, userID)
+	result, err := cp.DB.ExecContext(ctx, query, conversationID, userID)
 	if err != nil {
 		errorText := err.Error()
 
@@ -78,5 +178,316 @@ func (cp *ConversationParticipantModel) AddParticipant(ctx context.Context, conv
 		}
 	}
 
-	return nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrConversationParticipantBanned
+	}
+
+	// The count is checked after inserting so failed inserts don't change it.
+	// Updating the row also serializes concurrent additions, so the limit can't be exceeded.
+	query = `
+	UPDATE group_metadata
+	SET member_count = member_count + 1
+	WHERE conversation_id = $1 AND member_count < $2
+	`
+
+	result, err = cp.DB.ExecContext(ctx, query, conversationID, maxMembers)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrGroupFull
+	}
+
+	return recordChange(ctx, cp.DB, Change{
+		ConversationID: *conversationID,
+		Entity:         ChangeEntityParticipant,
+		EntityID:       *userID,
+		Action:         ChangeActionCreated,
+		UserID:         userID,
+	})
+}
+
+// GetRole returns the role of the user in the conversation of the given type.
+// ErrNoRecordFound is returned if the user is not a participant.
+func (cpm *ConversationParticipantModel) GetRole(ctx context.Context, userID, conversationID uuid.UUID, conversationType string) (string, error) {
+	query := `
+	SELECT cp.role
+	FROM conversation_participants cp
+	JOIN conversations c ON cp.conversation_id = c.id
+	WHERE cp.user_id = $1 AND cp.conversation_id = $2 AND c.type = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var role string
+
+	err := cpm.DB.QueryRowContext(ctx, query, userID, conversationID, conversationType).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNoRecordFound
+		default:
+			return "", err
+		}
+	}
+
+	return role, nil
+}
+
+// UpdateRole changes the role of a participant.
+// ErrNoRecordFound is returned if the user is not a participant.
+func (cpm *ConversationParticipantModel) UpdateRole(ctx context.Context, conversationID, userID uuid.UUID, role string) error {
+	query := `UPDATE conversation_participants SET role = $1 WHERE conversation_id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cpm.DB.ExecContext(ctx, query, role, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return recordChange(ctx, cpm.DB, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityParticipant,
+		EntityID:       userID,
+		Action:         ChangeActionUpdated,
+		UserID:         &userID,
+	})
+}
+
+// RemoveParticipant removes the user from the conversation along with their draft in it.
+// ErrNoRecordFound is returned if the user is not a participant.
+func (cpm *ConversationParticipantModel) RemoveParticipant(ctx context.Context, conversationID, userID uuid.UUID) error {
+	query := `DELETE FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cpm.DB.ExecContext(ctx, query, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	query = `DELETE FROM conversation_drafts WHERE conversation_id = $1 AND user_id = $2`
+
+	if _, err := cpm.DB.ExecContext(ctx, query, conversationID, userID); err != nil {
+		return err
+	}
+
+	query = `UPDATE group_metadata SET member_count = member_count - 1 WHERE conversation_id = $1`
+
+	if _, err := cpm.DB.ExecContext(ctx, query, conversationID); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cpm.DB, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityParticipant,
+		EntityID:       userID,
+		Action:         ChangeActionDeleted,
+		UserID:         &userID,
+	})
+}
+
+// GetSuccessor returns the participant who should own the group once its owner leaves:
+// the longest-standing admin, or the longest-standing member if there are no admins.
+// ErrNoRecordFound is returned if the owner is the only participant.
+func (cpm *ConversationParticipantModel) GetSuccessor(ctx context.Context, conversationID, ownerID uuid.UUID) (uuid.UUID, error) {
+	query := `
+	SELECT user_id
+	FROM conversation_participants
+	WHERE conversation_id = $1 AND user_id <> $2
+	ORDER BY role = 'admin' DESC, created_at ASC
+	LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var successorID uuid.UUID
+
+	err := cpm.DB.QueryRowContext(ctx, query, conversationID, ownerID).Scan(&successorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return uuid.Nil, ErrNoRecordFound
+		default:
+			return uuid.Nil, err
+		}
+	}
+
+	return successorID, nil
+}
+
+// GetAllForGroup lists the participants of a group, optionally only those whose username starts with search.
+func (cpm *ConversationParticipantModel) GetAllForGroup(ctx context.Context, groupID uuid.UUID, search string, f filter.Filters) ([]*GroupParticipant, *filter.PaginationMetadata, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		count(*) OVER(),
+		u.id, u.username, u.bio, u.is_active,
+		cp.role AS role, cp.created_at AS joined_at
+	FROM conversation_participants cp
+	JOIN users u ON u.id = cp.user_id
+	WHERE cp.conversation_id = $1 AND ($2 = '' OR u.username LIKE $2 || '%%')
+	ORDER BY %s %s, cp.user_id ASC
+	LIMIT $3 OFFSET $4
+	`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Wildcards are escaped so search is only ever a prefix match.
+	search = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search)
+
+	rows, err := cpm.DB.QueryContext(ctx, query, groupID, search, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	participants := make([]*GroupParticipant, 0)
+
+	for rows.Next() {
+		p := GroupParticipant{User: &User{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&p.User.ID,
+			&p.User.Username,
+			&p.User.Bio,
+			&p.User.IsActive,
+			&p.Role,
+			&p.JoinedAt,
+		)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		participants = append(participants, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return participants, paginationMetadata, nil
+}
+
+// Subscribe adds the user to the channel as a member and increments its member count.
+// It should be run in a transaction. ErrConversationParticipantDuplicate is returned if the user is already subscribed.
+func (cpm *ConversationParticipantModel) Subscribe(ctx context.Context, channelID, userID uuid.UUID) error {
+	query := `INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := cpm.DB.ExecContext(ctx, query, channelID, userID)
+	if err != nil {
+		errorText := err.Error()
+
+		switch {
+		case strings.Contains(errorText, `pq: duplicate key value violates unique constraint "unique_participant"`):
+			return ErrConversationParticipantDuplicate
+		case strings.Contains(errorText, `pq: insert or update on table "conversation_participants" violates foreign key constraint "conversation_participants_conversation_id_fkey"`):
+			return ErrConversationDoesNotExist
+		default:
+			return err
+		}
+	}
+
+	query = `UPDATE group_metadata SET member_count = member_count + 1 WHERE conversation_id = $1`
+
+	if _, err := cpm.DB.ExecContext(ctx, query, channelID); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cpm.DB, Change{
+		ConversationID: channelID,
+		Entity:         ChangeEntitySubscription,
+		EntityID:       userID,
+		Action:         ChangeActionCreated,
+		UserID:         &userID,
+	})
+}
+
+// Unsubscribe removes the user from the channel along with their draft in it and decrements its member count.
+// It should be run in a transaction. ErrNoRecordFound is returned if the user is not subscribed.
+func (cpm *ConversationParticipantModel) Unsubscribe(ctx context.Context, channelID, userID uuid.UUID) error {
+	query := `DELETE FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := cpm.DB.ExecContext(ctx, query, channelID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	query = `DELETE FROM conversation_drafts WHERE conversation_id = $1 AND user_id = $2`
+
+	if _, err := cpm.DB.ExecContext(ctx, query, channelID, userID); err != nil {
+		return err
+	}
+
+	query = `UPDATE group_metadata SET member_count = member_count - 1 WHERE conversation_id = $1`
+
+	if _, err := cpm.DB.ExecContext(ctx, query, channelID); err != nil {
+		return err
+	}
+
+	return recordChange(ctx, cpm.DB, Change{
+		ConversationID: channelID,
+		Entity:         ChangeEntitySubscription,
+		EntityID:       userID,
+		Action:         ChangeActionDeleted,
+		UserID:         &userID,
+	})
 }
@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+// MaxPinnedConversations is how many conversations a user can pin to the top of their inbox.
+const MaxPinnedConversations = 5
+
+// archivedCondition tells whether the preferences p of conversation c are archived. Conversations are archived as of
+// a time, and come back to the inbox once their latest message is newer, unless they are muted.
+// Comparing them when reading spares inserting messages from updating the preferences of every participant.
+const archivedCondition = `(p.archived_at IS NOT NULL AND (
+	p.muted_until > NOW() OR
+	p.archived_at >= coalesce((SELECT lm.created_at FROM conversation_messages lm WHERE lm.id = c.last_message_id), '-infinity')
+))`
+
+var (
+	ErrPinLimitReached = errors.New("pinned conversation limit reached")
+)
+
+// ConversationPreferences are the settings of a participant for a conversation, which only affect how it's shown to them.
+// Archived conversations are unarchived when a new message arrives, unless they are muted.
+// Conversations are only unread once they have been marked as read, and then have newer messages.
+type ConversationPreferences struct {
+	UserID         uuid.UUID  `json:"-"`
+	ConversationID uuid.UUID  `json:"-"`
+	MutedUntil     *time.Time `json:"muted_until"`
+	Pinned         bool       `json:"pinned"`
+	Archived       bool       `json:"archived"`
+	Unread         bool       `json:"unread"`
+	ClearedAt      *time.Time `json:"cleared_at"`
+}
+
+type ConversationPreferencesModel struct {
+	DB DBOperator
+}
+
+func ValidateConversationPreferences(v *validator.Validator, preferences *ConversationPreferences) {
+	v.Check(preferences.MutedUntil == nil || preferences.MutedUntil.After(time.Now()), "muted_until", "must be in the future")
+}
+
+// Get returns the preferences of the user for the conversation, which are the defaults if they never changed them.
+// Mutes that already ended are left out.
+func (cpm *ConversationPreferencesModel) Get(ctx context.Context, conversationID, userID uuid.UUID) (*ConversationPreferences, error) {
+	preferences, err := cpm.GetMany(ctx, userID, []uuid.UUID{conversationID})
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := preferences[conversationID]; ok {
+		return p, nil
+	}
+
+	return &ConversationPreferences{UserID: userID, ConversationID: conversationID}, nil
+}
+
+// GetMany returns the preferences of the user for the conversations with the given ids, by conversation id.
+// Conversations whose preferences the user never changed are left out.
+func (cpm *ConversationPreferencesModel) GetMany(ctx context.Context, userID uuid.UUID, conversationIDs []uuid.UUID) (map[uuid.UUID]*ConversationPreferences, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		p.conversation_id, CASE WHEN p.muted_until > NOW() THEN p.muted_until END, p.pinned_at IS NOT NULL, %s,
+		p.last_read_message_id IS NOT NULL AND c.last_message_id IS DISTINCT FROM p.last_read_message_id, p.cleared_at
+	FROM conversation_preferences p
+	JOIN conversations c ON c.id = p.conversation_id
+	WHERE p.user_id = $1 AND p.conversation_id = ANY($2::uuid[])
+	`, archivedCondition)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := cpm.DB.QueryContext(ctx, query, userID, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make(map[uuid.UUID]*ConversationPreferences, len(conversationIDs))
+
+	for rows.Next() {
+		preferences := ConversationPreferences{UserID: userID}
+
+		err := rows.Scan(&preferences.ConversationID, &preferences.MutedUntil, &preferences.Pinned, &preferences.Archived, &preferences.Unread, &preferences.ClearedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		result[preferences.ConversationID] = &preferences
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Upsert saves the preferences of the user for the conversation, who must be a participant.
+// Pinned conversations keep the time they were first pinned at, which orders them, and archiving
+// a conversation archives the messages it has until now.
+// It must be run in a transaction. ErrPinLimitReached is returned if the user would pin more than MaxPinnedConversations.
+func (cpm *ConversationPreferencesModel) Upsert(ctx context.Context, preferences *ConversationPreferences) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if preferences.Pinned {
+		if err := lockUser(ctx, cpm.DB, preferences.UserID); err != nil {
+			return err
+		}
+
+		query := `
+		SELECT count(*) FROM conversation_preferences
+		WHERE user_id = $1 AND conversation_id <> $2 AND pinned_at IS NOT NULL
+		`
+
+		var count int
+
+		if err := cpm.DB.QueryRowContext(ctx, query, preferences.UserID, preferences.ConversationID).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= MaxPinnedConversations {
+			return ErrPinLimitReached
+		}
+	}
+
+	query := `
+	INSERT INTO conversation_preferences (conversation_id, user_id, muted_until, pinned_at, archived_at)
+	VALUES ($1, $2, $3, CASE WHEN $4 THEN NOW() END, CASE WHEN $5 THEN NOW() END)
+	ON CONFLICT (conversation_id, user_id) DO UPDATE
+	SET
+		muted_until = EXCLUDED.muted_until,
+		pinned_at = CASE WHEN $4 THEN coalesce(conversation_preferences.pinned_at, NOW()) END,
+		archived_at = EXCLUDED.archived_at,
+		updated_at = NOW()
+	`
+
+	args := []any{preferences.ConversationID, preferences.UserID, preferences.MutedUntil, preferences.Pinned, preferences.Archived}
+
+	if _, err := cpm.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return recordPreferencesChange(ctx, cpm.DB, preferences.ConversationID, preferences.UserID)
+}
+
+// MarkRead marks the conversation as read by the user up to its latest message, which starts tracking whether it's unread.
+// The user must be a participant.
+func (cpm *ConversationPreferencesModel) MarkRead(ctx context.Context, conversationID, userID uuid.UUID) error {
+	query := `
+	INSERT INTO conversation_preferences (conversation_id, user_id, last_read_message_id)
+	SELECT id, $2, last_message_id FROM conversations WHERE id = $1
+	ON CONFLICT (conversation_id, user_id) DO UPDATE
+	SET last_read_message_id = EXCLUDED.last_read_message_id, updated_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := cpm.DB.ExecContext(ctx, query, conversationID, userID); err != nil {
+		return err
+	}
+
+	return recordPreferencesChange(ctx, cpm.DB, conversationID, userID)
+}
+
+// recordPreferencesChange appends a change of the preferences of the user for the conversation to the change log.
+// Preferences are identified by their conversation, and only synced to the user.
+func recordPreferencesChange(ctx context.Context, db DBOperator, conversationID, userID uuid.UUID) error {
+	return recordChange(ctx, db, Change{
+		ConversationID: conversationID,
+		Entity:         ChangeEntityPreferences,
+		EntityID:       conversationID,
+		Action:         ChangeActionUpdated,
+		UserID:         &userID,
+	})
+}
+
+// ClearHistory hides the messages of the conversation sent until now from the user, who must be a participant.
+// It should be run in a transaction.
+func (cpm *ConversationPreferencesModel) ClearHistory(ctx context.Context, conversationID, userID uuid.UUID) error {
+	query := `
+	INSERT INTO conversation_preferences (conversation_id, user_id, cleared_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (conversation_id, user_id) DO UPDATE
+	SET cleared_at = EXCLUDED.cleared_at, updated_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := cpm.DB.ExecContext(ctx, query, conversationID, userID); err != nil {
+		return err
+	}
+
+	// The user's other devices learn of the new cleared_at from the preferences, and drop the messages before it.
+	return recordPreferencesChange(ctx, cpm.DB, conversationID, userID)
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const maxInviteTTL = 365 * 24 * time.Hour
+
+type GroupInvite struct {
+	ID               uuid.UUID  `json:"id"`
+	Code             string     `json:"code,omitempty"` // Only known when the invite is created.
+	Hash             []byte     `json:"-"`
+	ConversationID   uuid.UUID  `json:"group_id"`
+	CreatedBy        uuid.UUID  `json:"created_by"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	MaxUses          *int       `json:"max_uses"`
+	Uses             int        `json:"uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type GroupInviteModel struct {
+	DB DBOperator
+}
+
+func ValidateGroupInvite(v *validator.Validator, invite *GroupInvite) {
+	if invite.ExpiresAt != nil {
+		v.Check(invite.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+		v.Check(invite.ExpiresAt.Before(time.Now().Add(maxInviteTTL)), "expires_at", "must be within a year")
+	}
+
+	if invite.MaxUses != nil {
+		v.Check(*invite.MaxUses > 0, "max_uses", "must be greater than zero")
+		v.Check(*invite.MaxUses <= 100_000, "max_uses", "must be a maximum of 100000")
+	}
+}
+
+func ValidateInviteCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 26, "code", "must be 26 bytes long")
+}
+
+// Insert generates the code of the invite and stores its hash.
+func (gim *GroupInviteModel) Insert(ctx context.Context, invite *GroupInvite) error {
+	code, err := generateTokenPlaintext()
+	if err != nil {
+		return err
+	}
+
+	invite.Code = code
+	invite.Hash = hashToken(code)
+
+	query := `
+	INSERT INTO group_invites (hash, conversation_id, created_by, expires_at, max_uses, requires_approval)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{invite.Hash, invite.ConversationID, invite.CreatedBy, invite.ExpiresAt, invite.MaxUses, invite.RequiresApproval}
+
+	return gim.DB.QueryRowContext(ctx, query, args...).Scan(&invite.ID, &invite.CreatedAt)
+}
+
+// GetByCode returns the invite with the given code if it can still be used.
+// ErrNoRecordFound is returned for unknown, revoked, expired and used up invites alike.
+func (gim *GroupInviteModel) GetByCode(ctx context.Context, code string) (*GroupInvite, error) {
+	query := `
+	SELECT id, conversation_id, created_by, expires_at, max_uses, uses, requires_approval, created_at
+	FROM group_invites
+	WHERE hash = $1
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_uses IS NULL OR uses < max_uses)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	invite := GroupInvite{Hash: hashToken(code)}
+
+	err := gim.DB.QueryRowContext(ctx, query, invite.Hash).Scan(
+		&invite.ID,
+		&invite.ConversationID,
+		&invite.CreatedBy,
+		&invite.ExpiresAt,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.RequiresApproval,
+		&invite.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invite, nil
+}
+
+// GetAllForGroup lists the invites of the group that have not been revoked, newest first.
+func (gim *GroupInviteModel) GetAllForGroup(ctx context.Context, groupID uuid.UUID) ([]*GroupInvite, error) {
+	query := `
+	SELECT id, conversation_id, created_by, expires_at, max_uses, uses, requires_approval, created_at
+	FROM group_invites
+	WHERE conversation_id = $1 AND revoked_at IS NULL
+	ORDER BY created_at DESC, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := gim.DB.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invites := make([]*GroupInvite, 0)
+
+	for rows.Next() {
+		var invite GroupInvite
+
+		err := rows.Scan(
+			&invite.ID,
+			&invite.ConversationID,
+			&invite.CreatedBy,
+			&invite.ExpiresAt,
+			&invite.MaxUses,
+			&invite.Uses,
+			&invite.RequiresApproval,
+			&invite.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invites = append(invites, &invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// Use counts a use of the invite.
+// ErrNoRecordFound is returned if the invite can't be used anymore, e.g. its last use was taken concurrently.
+func (gim *GroupInviteModel) Use(ctx context.Context, inviteID uuid.UUID) error {
+	query := `
+	UPDATE group_invites
+	SET uses = uses + 1
+	WHERE id = $1
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_uses IS NULL OR uses < max_uses)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := gim.DB.ExecContext(ctx, query, inviteID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// Revoke revokes an invite of the group so it can't be used anymore.
+// ErrNoRecordFound is returned if the group has no such invite or it's already revoked.
+func (gim *GroupInviteModel) Revoke(ctx context.Context, groupID, inviteID uuid.UUID) error {
+	query := `
+	UPDATE group_invites
+	SET revoked_at = NOW()
+	WHERE id = $1 AND conversation_id = $2 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := gim.DB.ExecContext(ctx, query, inviteID, groupID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+	JoinRequestExpired  = "expired"
+)
+
+// GroupJoinRequest is a request to join a group which has to be approved by its owner or an admin.
+// Pending requests older than the configured ttl are considered expired.
+type GroupJoinRequest struct {
+	ID             uuid.UUID  `json:"id"`
+	ConversationID uuid.UUID  `json:"group_id"`
+	UserID         uuid.UUID  `json:"-"`
+	User           *User      `json:"user,omitempty"`
+	InviteID       *uuid.UUID `json:"-"`
+	Message        *string    `json:"message"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type GroupJoinRequestModel struct {
+	DB DBOperator
+}
+
+var (
+	ErrJoinRequestDuplicate    = errors.New("duplicate join request")
+	ErrJoinRequestLimitReached = errors.New("join request limit reached")
+)
+
+func ValidateGroupJoinRequest(v *validator.Validator, request *GroupJoinRequest) {
+	if request.Message != nil {
+		v.Check(*request.Message != "", "message", "must not be empty")
+		v.Check(len(*request.Message) <= 500, "message", "must not be more than 500 bytes long")
+	}
+}
+
+// Insert submits a pending join request. Stale pending requests of the user for the group are expired first.
+// It must be run in a transaction. ErrJoinRequestDuplicate is returned if the user already has a pending request,
+// and ErrJoinRequestLimitReached if they submitted perHour requests in the last hour.
+func (jrm *GroupJoinRequestModel) Insert(ctx context.Context, request *GroupJoinRequest, ttl time.Duration, perHour int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := lockUser(ctx, jrm.DB, request.UserID); err != nil {
+		return err
+	}
+
+	query := `SELECT count(*) FROM group_join_requests WHERE user_id = $1 AND created_at > $2`
+
+	var count int
+
+	if err := jrm.DB.QueryRowContext(ctx, query, request.UserID, time.Now().Add(-time.Hour)).Scan(&count); err != nil {
+		return err
+	}
+
+	if count >= perHour {
+		return ErrJoinRequestLimitReached
+	}
+
+	query = `
+	UPDATE group_join_requests
+	SET status = 'expired'
+	WHERE conversation_id = $1 AND user_id = $2 AND status = 'pending' AND created_at <= $3
+	`
+
+	_, err := jrm.DB.ExecContext(ctx, query, request.ConversationID, request.UserID, time.Now().Add(-ttl))
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO group_join_requests (conversation_id, user_id, invite_id, message)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, status, created_at
+	`
+
+	args := []any{request.ConversationID, request.UserID, request.InviteID, request.Message}
+
+	err = jrm.DB.QueryRowContext(ctx, query, args...).Scan(&request.ID, &request.Status, &request.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `pq: duplicate key value violates unique constraint "group_join_requests_pending_key"`):
+			return ErrJoinRequestDuplicate
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllPendingForGroup lists the pending join requests of a group which have not expired, along with their users.
+func (jrm *GroupJoinRequestModel) GetAllPendingForGroup(ctx context.Context, groupID uuid.UUID, ttl time.Duration, f filter.Filters) ([]*GroupJoinRequest, *filter.PaginationMetadata, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		count(*) OVER(),
+		jr.id, jr.message, jr.status, jr.created_at,
+		u.id, u.username, u.bio, u.is_active
+	FROM group_join_requests jr
+	JOIN users u ON u.id = jr.user_id
+	WHERE jr.conversation_id = $1 AND jr.status = 'pending' AND jr.created_at > $2
+	ORDER BY jr.%s %s, jr.id ASC
+	LIMIT $3 OFFSET $4
+	`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := jrm.DB.QueryContext(ctx, query, groupID, time.Now().Add(-ttl), f.Limit(), f.Offset())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	requests := make([]*GroupJoinRequest, 0)
+
+	for rows.Next() {
+		request := GroupJoinRequest{ConversationID: groupID, User: &User{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&request.ID,
+			&request.Message,
+			&request.Status,
+			&request.CreatedAt,
+			&request.User.ID,
+			&request.User.Username,
+			&request.User.Bio,
+			&request.User.IsActive,
+		)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		request.UserID = request.User.ID
+
+		requests = append(requests, &request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return requests, paginationMetadata, nil
+}
+
+// Decide approves or rejects a pending join request of the group which has not expired.
+// ErrNoRecordFound is returned if there's no such request.
+func (jrm *GroupJoinRequestModel) Decide(ctx context.Context, request *GroupJoinRequest, status string, decidedBy uuid.UUID, ttl time.Duration) error {
+	query := `
+	UPDATE group_join_requests
+	SET status = $1, decided_by = $2, decided_at = NOW()
+	WHERE id = $3 AND conversation_id = $4 AND status = 'pending' AND created_at > $5
+	RETURNING user_id, invite_id, message, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{status, decidedBy, request.ID, request.ConversationID, time.Now().Add(-ttl)}
+
+	err := jrm.DB.QueryRowContext(ctx, query, args...).Scan(&request.UserID, &request.InviteID, &request.Message, &request.Status, &request.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoRecordFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const (
+	RestrictionMute = "mute"
+	RestrictionBan  = "ban"
+)
+
+const maxRestrictionTTL = 365 * 24 * time.Hour
+
+// GroupRestriction is a mute or ban of a user in a group, lasting until it expires or is lifted.
+type GroupRestriction struct {
+	ConversationID uuid.UUID  `json:"group_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Type           string     `json:"type"`
+	Reason         *string    `json:"reason"`
+	CreatedBy      uuid.UUID  `json:"created_by"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type GroupRestrictionModel struct {
+	DB DBOperator
+}
+
+func ValidateGroupRestriction(v *validator.Validator, restriction *GroupRestriction) {
+	if restriction.Reason != nil {
+		v.Check(*restriction.Reason != "", "reason", "must not be empty")
+		v.Check(len(*restriction.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	}
+
+	if restriction.ExpiresAt != nil {
+		v.Check(restriction.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+		v.Check(restriction.ExpiresAt.Before(time.Now().Add(maxRestrictionTTL)), "expires_at", "must be within a year")
+	}
+}
+
+// Upsert restricts the user, replacing any restriction of the same type they already have in the group.
+// ErrUserDoesNotExist is returned if the user does not exist.
+func (grm *GroupRestrictionModel) Upsert(ctx context.Context, restriction *GroupRestriction) error {
+	query := `
+	INSERT INTO group_restrictions (conversation_id, user_id, type, reason, created_by, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (conversation_id, user_id, type) DO UPDATE
+	SET reason = EXCLUDED.reason, created_by = EXCLUDED.created_by, expires_at = EXCLUDED.expires_at, created_at = NOW()
+	RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{
+		restriction.ConversationID,
+		restriction.UserID,
+		restriction.Type,
+		restriction.Reason,
+		restriction.CreatedBy,
+		restriction.ExpiresAt,
+	}
+
+	err := grm.DB.QueryRowContext(ctx, query, args...).Scan(&restriction.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `violates foreign key constraint "group_restrictions_user_id_fkey"`):
+			return ErrUserDoesNotExist
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsRestricted reports whether the user currently has a restriction of the given type in the group.
+func (grm *GroupRestrictionModel) IsRestricted(ctx context.Context, groupID, userID uuid.UUID, restrictionType string) (bool, error) {
+	query := `
+	SELECT EXISTS(
+		SELECT 1
+		FROM group_restrictions
+		WHERE conversation_id = $1 AND user_id = $2 AND type = $3 AND (expires_at IS NULL OR expires_at > NOW())
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var restricted bool
+
+	err := grm.DB.QueryRowContext(ctx, query, groupID, userID, restrictionType).Scan(&restricted)
+
+	return restricted, err
+}
+
+// GetAllForGroup lists the restrictions of the given type in effect in the group, newest first.
+func (grm *GroupRestrictionModel) GetAllForGroup(ctx context.Context, groupID uuid.UUID, restrictionType string) ([]*GroupRestriction, error) {
+	query := `
+	SELECT conversation_id, user_id, type, reason, created_by, expires_at, created_at
+	FROM group_restrictions
+	WHERE conversation_id = $1 AND type = $2 AND (expires_at IS NULL OR expires_at > NOW())
+	ORDER BY created_at DESC, user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := grm.DB.QueryContext(ctx, query, groupID, restrictionType)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	restrictions := make([]*GroupRestriction, 0)
+
+	for rows.Next() {
+		var restriction GroupRestriction
+
+		err := rows.Scan(
+			&restriction.ConversationID,
+			&restriction.UserID,
+			&restriction.Type,
+			&restriction.Reason,
+			&restriction.CreatedBy,
+			&restriction.ExpiresAt,
+			&restriction.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		restrictions = append(restrictions, &restriction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// Lift removes the restriction of the given type from the user.
+// ErrNoRecordFound is returned if the user has no such restriction in effect.
+func (grm *GroupRestrictionModel) Lift(ctx context.Context, groupID, userID uuid.UUID, restrictionType string) error {
+	query := `
+	DELETE FROM group_restrictions
+	WHERE conversation_id = $1 AND user_id = $2 AND type = $3 AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := grm.DB.ExecContext(ctx, query, groupID, userID, restrictionType)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
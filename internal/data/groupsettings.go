@@ -0,0 +1,44 @@
+package data
+
+import (
+	"slices"
+
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const (
+	GroupAudienceEveryone = "everyone"
+	GroupAudienceAdmins   = "admins"
+)
+
+const maxSlowModeInterval = 24 * 60 * 60
+
+// GroupSettings controls what the members of a group are allowed to do.
+// The owner and admins are never restricted by them.
+type GroupSettings struct {
+	SendMessages string `json:"send_messages"`
+	SendMedia    string `json:"send_media"`
+	AddMembers   string `json:"add_members"`
+	// SlowModeInterval is the minimum number of seconds between messages of a member, 0 when slow mode is off.
+	SlowModeInterval int `json:"slow_mode_interval"`
+}
+
+// AudienceIncludes reports whether participants with the given role are part of the audience.
+func AudienceIncludes(audience, role string) bool {
+	return audience == GroupAudienceEveryone || role == RoleOwner || role == RoleAdmin
+}
+
+// IsMediaMessage reports whether messages of the given type are media, which groups can restrict separately.
+func IsMediaMessage(messageType string) bool {
+	return slices.Contains([]string{TypeImageMessage, TypeVideoMessage, TypeAudioMessage, TypeFileMessage}, messageType)
+}
+
+func ValidateGroupSettings(v *validator.Validator, settings *GroupSettings) {
+	audiences := []string{GroupAudienceEveryone, GroupAudienceAdmins}
+
+	v.Check(slices.Contains(audiences, settings.SendMessages), "send_messages", "must be either everyone or admins")
+	v.Check(slices.Contains(audiences, settings.SendMedia), "send_media", "must be either everyone or admins")
+	v.Check(slices.Contains(audiences, settings.AddMembers), "add_members", "must be either everyone or admins")
+	v.Check(settings.SlowModeInterval >= 0, "slow_mode_interval", "must not be negative")
+	v.Check(settings.SlowModeInterval <= maxSlowModeInterval, "slow_mode_interval", "must be at most a day")
+}
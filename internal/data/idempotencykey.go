@@ -0,0 +1,145 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+type IdempotencyKey struct {
+	UserID       uuid.UUID
+	Key          string
+	RequestHash  []byte
+	StatusCode   *int
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
+
+type IdempotencyKeyModel struct {
+	DB DBOperator
+}
+
+// IsCompleted reports whether the response of the original request has been stored.
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.StatusCode != nil
+}
+
+func ValidateIdempotencyKey(v *validator.Validator, key string) {
+	v.Check(key != "", "Idempotency-Key", "must not be empty")
+	v.Check(len(key) <= 255, "Idempotency-Key", "must not be more than 255 bytes long")
+}
+
+// Reserve claims the key for a new request. Keys older than ttl are considered expired and reclaimed.
+// If false is returned, the key is already taken and can be read with Get.
+func (m *IdempotencyKeyModel) Reserve(ctx context.Context, key *IdempotencyKey, ttl time.Duration) (bool, error) {
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, request_hash)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_body = NULL, created_at = NOW()
+	WHERE idempotency_keys.created_at < $4
+	RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{key.UserID, key.Key, key.RequestHash, time.Now().Add(-ttl)}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&key.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (m *IdempotencyKeyModel) Get(ctx context.Context, userID uuid.UUID, key string) (*IdempotencyKey, error) {
+	query := `
+	SELECT user_id, key, request_hash, status_code, response_body, created_at
+	FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var k IdempotencyKey
+
+	err := m.DB.QueryRowContext(ctx, query, userID, key).Scan(
+		&k.UserID,
+		&k.Key,
+		&k.RequestHash,
+		&k.StatusCode,
+		&k.ResponseBody,
+		&k.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &k, nil
+}
+
+// Complete stores the response of the original request so retries can replay it.
+func (m *IdempotencyKeyModel) Complete(ctx context.Context, key *IdempotencyKey) error {
+	query := `
+	UPDATE idempotency_keys
+	SET status_code = $1, response_body = $2
+	WHERE user_id = $3 AND key = $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key.StatusCode, key.ResponseBody, key.UserID, key.Key)
+
+	return err
+}
+
+// Release frees the key, e.g. when the original request failed, so it can be retried.
+func (m *IdempotencyKeyModel) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+
+	return err
+}
+
+// DeleteExpired deletes up to limit keys older than ttl and returns how many were deleted.
+func (m *IdempotencyKeyModel) DeleteExpired(ctx context.Context, ttl time.Duration, limit int) (int64, error) {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE (user_id, key) IN (
+		SELECT user_id, key FROM idempotency_keys WHERE created_at < $1 LIMIT $2
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-ttl), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
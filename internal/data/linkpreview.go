@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	ImageURL    *string   `json:"image_url"`
+	SiteName    *string   `json:"site_name"`
+	FetchedAt   time.Time `json:"-"`
+}
+
+type LinkPreviewModel struct {
+	DB DBOperator
+}
+
+// GetFresh returns the cached preview of url if it was fetched less than ttl ago.
+func (lpm *LinkPreviewModel) GetFresh(ctx context.Context, url string, ttl time.Duration) (*LinkPreview, error) {
+	query := `
+	SELECT url, title, description, image_url, site_name, fetched_at
+	FROM link_previews
+	WHERE url = $1 AND fetched_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var preview LinkPreview
+
+	err := lpm.DB.QueryRowContext(ctx, query, url, time.Now().Add(-ttl)).Scan(
+		&preview.URL,
+		&preview.Title,
+		&preview.Description,
+		&preview.ImageURL,
+		&preview.SiteName,
+		&preview.FetchedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &preview, nil
+}
+
+// Upsert caches the preview, replacing any stale entry for the same url.
+func (lpm *LinkPreviewModel) Upsert(ctx context.Context, preview *LinkPreview) error {
+	query := `
+	INSERT INTO link_previews (url, title, description, image_url, site_name)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (url) DO UPDATE
+	SET
+		title = EXCLUDED.title,
+		description = EXCLUDED.description,
+		image_url = EXCLUDED.image_url,
+		site_name = EXCLUDED.site_name,
+		fetched_at = NOW()
+	RETURNING fetched_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []any{preview.URL, preview.Title, preview.Description, preview.ImageURL, preview.SiteName}
+
+	return lpm.DB.QueryRowContext(ctx, query, args...).Scan(&preview.FetchedAt)
+}
+
+// HasFailedRecently reports whether fetching the preview of url failed less than ttl ago.
+func (lpm *LinkPreviewModel) HasFailedRecently(ctx context.Context, url string, ttl time.Duration) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM link_preview_failures WHERE url = $1 AND failed_at > $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var failed bool
+
+	err := lpm.DB.QueryRowContext(ctx, query, url, time.Now().Add(-ttl)).Scan(&failed)
+
+	return failed, err
+}
+
+// RecordFailure remembers that fetching the preview of url failed, so it's not fetched again right away.
+func (lpm *LinkPreviewModel) RecordFailure(ctx context.Context, url string) error {
+	query := `
+	INSERT INTO link_preview_failures (url)
+	VALUES ($1)
+	ON CONFLICT (url) DO UPDATE SET failed_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := lpm.DB.ExecContext(ctx, query, url)
+
+	return err
+}
+
+// AttachToMessage links a cached preview to a message.
+func (lpm *LinkPreviewModel) AttachToMessage(ctx context.Context, messageID uuid.UUID, url string) error {
+	query := `UPDATE conversation_messages SET link_preview_url = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := lpm.DB.ExecContext(ctx, query, url, messageID)
+	if err != nil {
+		return err
+	}
+
+	return recordMessageChange(ctx, lpm.DB, messageID, ChangeActionUpdated)
+}
+
+// attachLinkPreviews loads the link previews of the given messages and attaches them.
+func attachLinkPreviews(ctx context.Context, db DBOperator, messages ...*ConversationMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+
+	for _, m := range messages {
+		messageIDs = append(messageIDs, m.ID)
+	}
+
+	query := `
+	SELECT m.id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name, lp.fetched_at
+	FROM conversation_messages m
+	JOIN link_previews lp ON lp.url = m.link_preview_url
+	WHERE m.id = ANY($1::uuid[])
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	previews := make(map[uuid.UUID]*LinkPreview)
+
+	for rows.Next() {
+		var (
+			messageID uuid.UUID
+			preview   LinkPreview
+		)
+
+		err := rows.Scan(
+			&messageID,
+			&preview.URL,
+			&preview.Title,
+			&preview.Description,
+			&preview.ImageURL,
+			&preview.SiteName,
+			&preview.FetchedAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		previews[messageID] = &preview
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		m.LinkPreview = previews[m.ID]
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/thisisjab/gchat-go/internal/markup"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+const maxLiveLocationDuration = 8 * time.Hour
+
+type Location struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy,omitempty"`
+	Label     *string  `json:"label,omitempty"`
+	// LiveUntil is set for live locations which can be updated by the sender until it passes.
+	LiveUntil *time.Time `json:"live_until,omitempty"`
+}
+
+// Contact is either a reference to a user or a vCard.
+type Contact struct {
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	VCard  *string    `json:"vcard,omitempty"`
+	// User is only filled when rendering and never stored.
+	User *User `json:"user,omitempty"`
+}
+
+// messagePayload is the structured data of a message stored in the `payload` column.
+type messagePayload struct {
+	Location *Location       `json:"location,omitempty"`
+	Contact  *Contact        `json:"contact,omitempty"`
+	Entities []markup.Entity `json:"entities,omitempty"`
+	Event    *SystemEvent    `json:"event,omitempty"`
+}
+
+// IsLive reports whether the location is a live location that can still be updated.
+func (l *Location) IsLive() bool {
+	return l.LiveUntil != nil && l.LiveUntil.After(time.Now())
+}
+
+func ValidateLocation(v *validator.Validator, location *Location) {
+	v.Check(location.Latitude >= -90 && location.Latitude <= 90, "location.latitude", "must be between -90 and 90")
+	v.Check(location.Longitude >= -180 && location.Longitude <= 180, "location.longitude", "must be between -180 and 180")
+	v.Check(location.Accuracy == nil || *location.Accuracy >= 0, "location.accuracy", "must not be negative")
+	v.Check(location.Label == nil || len(*location.Label) <= 100, "location.label", "must not be more than 100 bytes long")
+
+	if location.LiveUntil != nil {
+		v.Check(location.LiveUntil.After(time.Now()), "location.live_until", "must be in the future")
+		v.Check(location.LiveUntil.Before(time.Now().Add(maxLiveLocationDuration)), "location.live_until", "must be within 8 hours")
+	}
+}
+
+func ValidateContact(v *validator.Validator, contact *Contact) {
+	v.Check(contact.UserID != nil || contact.VCard != nil, "contact", "must contain either user_id or vcard")
+	v.Check(contact.UserID == nil || contact.VCard == nil, "contact", "must not contain both user_id and vcard")
+
+	if contact.VCard != nil {
+		vcard := strings.TrimSpace(*contact.VCard)
+
+		v.Check(len(vcard) <= 4096, "contact.vcard", "must not be more than 4096 bytes long")
+		v.Check(strings.HasPrefix(vcard, "BEGIN:VCARD") && strings.HasSuffix(vcard, "END:VCARD"), "contact.vcard", "must be a valid vCard")
+	}
+}
+
+// payload returns the JSON stored in the `payload` column, which is NULL if the message has no structured data.
+// It's returned as a string since lib/pq sends byte slices as bytea.
+func (cm *ConversationMessage) payload() (sql.NullString, error) {
+	if cm.Location == nil && cm.Contact == nil && len(cm.Entities) == 0 && cm.Event == nil {
+		return sql.NullString{}, nil
+	}
+
+	p := messagePayload{Location: cm.Location, Entities: cm.Entities, Event: cm.Event}
+
+	if cm.Contact != nil {
+		p.Contact = &Contact{UserID: cm.Contact.UserID, VCard: cm.Contact.VCard}
+	}
+
+	js, err := json.Marshal(p)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(js), Valid: true}, nil
+}
+
+// setPayload fills the structured data of the message from the `payload` column.
+func (cm *ConversationMessage) setPayload(raw []byte) error {
+	if raw == nil {
+		return nil
+	}
+
+	var p messagePayload
+
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return err
+	}
+
+	cm.Location = p.Location
+	cm.Contact = p.Contact
+	cm.Entities = p.Entities
+	cm.Event = p.Event
+
+	return nil
+}
+
+// attachContactUsers loads the users referenced by contact messages so they can be rendered.
+func attachContactUsers(ctx context.Context, db DBOperator, messages ...*ConversationMessage) error {
+	userIDs := make([]uuid.UUID, 0)
+
+	for _, m := range messages {
+		if m.Contact != nil && m.Contact.UserID != nil {
+			userIDs = append(userIDs, *m.Contact.UserID)
+		}
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT id, username, bio, is_active
+	FROM users
+	WHERE id = ANY($1::uuid[])
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	users := make(map[uuid.UUID]*User)
+
+	for rows.Next() {
+		var user User
+
+		if err := rows.Scan(&user.ID, &user.Username, &user.Bio, &user.IsActive); err != nil {
+			return err
+		}
+
+		users[user.ID] = &user
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.Contact != nil && m.Contact.UserID != nil {
+			m.Contact.User = users[*m.Contact.UserID]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+type Poll struct {
+	Question       string        `json:"question"`
+	Options        []*PollOption `json:"options"`
+	MultipleChoice bool          `json:"multiple_choice"`
+	Anonymous      bool          `json:"anonymous"`
+	ClosesAt       *time.Time    `json:"closes_at"`
+	ClosedAt       *time.Time    `json:"closed_at"`
+	TotalVoters    int           `json:"total_voters"`
+	// OwnVote holds the ids of the options the requesting user voted for.
+	OwnVote []uuid.UUID `json:"own_vote"`
+}
+
+type PollOption struct {
+	ID        uuid.UUID `json:"id"`
+	Text      string    `json:"text"`
+	VoteCount int       `json:"vote_count"`
+	// VoterIDs is only filled for polls that are not anonymous.
+	VoterIDs []uuid.UUID `json:"voter_ids,omitempty"`
+}
+
+type MessagePollModel struct {
+	DB DBOperator
+}
+
+var (
+	ErrPollClosed       = errors.New("poll is closed")
+	ErrPollSingleChoice = errors.New("poll is single choice")
+)
+
+// IsClosed reports whether the poll has been closed manually or its close time has passed.
+func (p *Poll) IsClosed() bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !p.ClosesAt.After(time.Now()))
+}
+
+// HasOption reports whether optionID belongs to the poll.
+func (p *Poll) HasOption(optionID uuid.UUID) bool {
+	for _, option := range p.Options {
+		if option.ID == optionID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ValidatePoll(v *validator.Validator, poll *Poll) {
+	v.Check(poll.Question != "", "poll.question", "must be provided")
+	v.Check(len(poll.Question) <= 300, "poll.question", "must not be more than 300 bytes long")
+
+	v.Check(len(poll.Options) >= 2, "poll.options", "must contain at least 2 options")
+	v.Check(len(poll.Options) <= 10, "poll.options", "must not contain more than 10 options")
+
+	seen := make(map[string]bool, len(poll.Options))
+
+	for _, option := range poll.Options {
+		v.Check(option.Text != "", "poll.options", "must not contain empty options")
+		v.Check(len(option.Text) <= 100, "poll.options", "must not contain options more than 100 bytes long")
+		v.Check(!seen[option.Text], "poll.options", "must not contain duplicate options")
+
+		seen[option.Text] = true
+	}
+
+	v.Check(poll.ClosesAt == nil || poll.ClosesAt.After(time.Now()), "poll.closes_at", "must be in the future")
+}
+
+// ValidatePollVote checks the chosen options against the poll.
+func ValidatePollVote(v *validator.Validator, poll *Poll, optionIDs []uuid.UUID) {
+	v.Check(len(optionIDs) > 0, "option_ids", "must be provided")
+	v.Check(poll.MultipleChoice || len(optionIDs) <= 1, "option_ids", "must contain a single option")
+
+	seen := make(map[uuid.UUID]bool, len(optionIDs))
+
+	for _, optionID := range optionIDs {
+		v.Check(poll.HasOption(optionID), "option_ids", "must only contain options of the poll")
+		v.Check(!seen[optionID], "option_ids", "must not contain duplicate options")
+
+		seen[optionID] = true
+	}
+}
+
+// insertPoll stores the poll of a message along with its options.
+// It is meant to be called while inserting the message itself, preferably in a transaction.
+func insertPoll(ctx context.Context, db DBOperator, messageID uuid.UUID, poll *Poll) error {
+	query := `
+	INSERT INTO message_polls (message_id, question, is_multiple_choice, is_anonymous, closes_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	args := []any{messageID, poll.Question, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt}
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO message_poll_options (message_id, position, text)
+	VALUES ($1, $2, $3)
+	RETURNING id
+	`
+
+	for i, option := range poll.Options {
+		if err := db.QueryRowContext(ctx, query, messageID, i, option.Text).Scan(&option.ID); err != nil {
+			return err
+		}
+	}
+
+	poll.OwnVote = []uuid.UUID{}
+
+	return nil
+}
+
+// getPollsForMessages returns the polls of the given messages (keyed by message id) with live tallies.
+// Messages without a poll are not present in the result.
+func getPollsForMessages(ctx context.Context, db DBOperator, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]*Poll, error) {
+	polls := make(map[uuid.UUID]*Poll)
+
+	if len(messageIDs) == 0 {
+		return polls, nil
+	}
+
+	query := `
+	SELECT
+		p.message_id, p.question, p.is_multiple_choice, p.is_anonymous, p.closes_at, p.closed_at,
+		(SELECT count(DISTINCT pv.user_id) FROM message_poll_votes pv WHERE pv.message_id = p.message_id),
+		o.id, o.text,
+		count(v.user_id),
+		coalesce(bool_or(v.user_id = $2), false),
+		array_remove(array_agg(v.user_id ORDER BY v.created_at), NULL)
+	FROM message_polls p
+	JOIN message_poll_options o ON o.message_id = p.message_id
+	LEFT JOIN message_poll_votes v ON v.option_id = o.id
+	WHERE p.message_id = ANY($1::uuid[])
+	GROUP BY p.message_id, o.id
+	ORDER BY p.message_id, o.position
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(messageIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID   uuid.UUID
+			poll        Poll
+			option      PollOption
+			votedByUser bool
+			voterIDs    []uuid.UUID
+		)
+
+		err := rows.Scan(
+			&messageID,
+			&poll.Question,
+			&poll.MultipleChoice,
+			&poll.Anonymous,
+			&poll.ClosesAt,
+			&poll.ClosedAt,
+			&poll.TotalVoters,
+			&option.ID,
+			&option.Text,
+			&option.VoteCount,
+			&votedByUser,
+			pq.Array(&voterIDs),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, found := polls[messageID]; !found {
+			poll.Options = make([]*PollOption, 0)
+			poll.OwnVote = make([]uuid.UUID, 0)
+			polls[messageID] = &poll
+		}
+
+		p := polls[messageID]
+
+		if !p.Anonymous {
+			option.VoterIDs = voterIDs
+		}
+
+		if votedByUser {
+			p.OwnVote = append(p.OwnVote, option.ID)
+		}
+
+		p.Options = append(p.Options, &option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+// Get returns the poll of the given message with tallies as seen by viewerID.
+func (pm *MessagePollModel) Get(ctx context.Context, messageID, viewerID uuid.UUID) (*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	polls, err := getPollsForMessages(ctx, pm.DB, []uuid.UUID{messageID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, found := polls[messageID]
+	if !found {
+		return nil, ErrNoRecordFound
+	}
+
+	return poll, nil
+}
+
+// Vote replaces any previous vote of the user on the poll with the given options.
+// It must be run in a transaction. ErrPollClosed is returned if the poll is closed,
+// and ErrPollSingleChoice if it's single choice and more than one option is given.
+func (pm *MessagePollModel) Vote(ctx context.Context, messageID, userID uuid.UUID, optionIDs []uuid.UUID) error {
+	multipleChoice, err := pm.lockOpen(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	if !multipleChoice && len(optionIDs) > 1 {
+		return ErrPollSingleChoice
+	}
+
+	if err := pm.deleteVotes(ctx, messageID, userID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO message_poll_votes (message_id, option_id, user_id)
+	SELECT $1, option_id, $2
+	FROM unnest($3::uuid[]) AS option_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err = pm.DB.ExecContext(ctx, query, messageID, userID, pq.Array(optionIDs))
+	if err != nil {
+		return err
+	}
+
+	return recordMessageChange(ctx, pm.DB, messageID, ChangeActionUpdated)
+}
+
+// Retract removes all votes of the user on the poll.
+// It must be run in a transaction. ErrPollClosed is returned if the poll is closed.
+func (pm *MessagePollModel) Retract(ctx context.Context, messageID, userID uuid.UUID) error {
+	if _, err := pm.lockOpen(ctx, messageID); err != nil {
+		return err
+	}
+
+	if err := pm.deleteVotes(ctx, messageID, userID); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return recordMessageChange(ctx, pm.DB, messageID, ChangeActionUpdated)
+}
+
+// lockOpen locks the poll until the end of the transaction and reports whether it's multiple choice.
+// Votes and closing the poll wait for each other, so checks made under the lock hold until commit.
+// ErrPollClosed is returned if the poll is closed, and ErrNoRecordFound if it doesn't exist.
+func (pm *MessagePollModel) lockOpen(ctx context.Context, messageID uuid.UUID) (bool, error) {
+	query := `
+	SELECT is_multiple_choice, closed_at IS NOT NULL OR coalesce(closes_at <= NOW(), false)
+	FROM message_polls
+	WHERE message_id = $1
+	FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var multipleChoice, closed bool
+
+	err := pm.DB.QueryRowContext(ctx, query, messageID).Scan(&multipleChoice, &closed)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrNoRecordFound
+		default:
+			return false, err
+		}
+	}
+
+	if closed {
+		return false, ErrPollClosed
+	}
+
+	return multipleChoice, nil
+}
+
+func (pm *MessagePollModel) deleteVotes(ctx context.Context, messageID, userID uuid.UUID) error {
+	query := `DELETE FROM message_poll_votes WHERE message_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := pm.DB.ExecContext(ctx, query, messageID, userID)
+
+	return err
+}
+
+// Close closes the poll so no more votes can be cast or retracted.
+// ErrPollClosed is returned if the poll is already closed.
+func (pm *MessagePollModel) Close(ctx context.Context, messageID uuid.UUID) error {
+	query := `
+	UPDATE message_polls
+	SET closed_at = NOW()
+	WHERE message_id = $1 AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > NOW())
+	RETURNING message_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := pm.DB.QueryRowContext(ctx, query, messageID).Scan(&messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrPollClosed
+		default:
+			return err
+		}
+	}
+
+	return recordMessageChange(ctx, pm.DB, messageID, ChangeActionUpdated)
+}
@@ -1,21 +1,77 @@
 package data
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
 
 type Models struct {
+	db *sql.DB
+
+	Change                  ChangeModel
 	Conversation            ConversationModel
+	ConversationFolder      ConversationFolderModel
+	ConversationDraft       ConversationDraftModel
 	ConversationMessage     ConversationMessageModel
 	ConversationParticipant ConversationParticipantModel
+	ConversationPreferences ConversationPreferencesModel
+	GroupInvite             GroupInviteModel
+	GroupJoinRequest        GroupJoinRequestModel
+	GroupRestriction        GroupRestrictionModel
+	IdempotencyKey          IdempotencyKeyModel
+	LinkPreview             LinkPreviewModel
+	MessagePoll             MessagePollModel
+	StarredMessage          StarredMessageModel
 	Token                   TokenModel
 	User                    UserModel
 }
 
 func NewModels(db *sql.DB) *Models {
+	models := newModels(db)
+	models.db = db
+
+	return models
+}
+
+func newModels(db DBOperator) *Models {
 	return &Models{
+		Change:                  ChangeModel{DB: db},
 		Conversation:            ConversationModel{DB: db},
+		ConversationFolder:      ConversationFolderModel{DB: db},
+		ConversationDraft:       ConversationDraftModel{DB: db},
 		ConversationMessage:     ConversationMessageModel{DB: db},
 		ConversationParticipant: ConversationParticipantModel{DB: db},
+		ConversationPreferences: ConversationPreferencesModel{DB: db},
+		GroupInvite:             GroupInviteModel{DB: db},
+		GroupJoinRequest:        GroupJoinRequestModel{DB: db},
+		GroupRestriction:        GroupRestrictionModel{DB: db},
+		IdempotencyKey:          IdempotencyKeyModel{DB: db},
+		LinkPreview:             LinkPreviewModel{DB: db},
+		MessagePoll:             MessagePollModel{DB: db},
+		StarredMessage:          StarredMessageModel{DB: db},
 		Token:                   TokenModel{DB: db},
 		User:                    UserModel{DB: db},
 	}
 }
+
+// Transaction runs fn with a set of models bound to a single database transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+func (m *Models) Transaction(ctx context.Context, fn func(tx *Models) error) error {
+	if m.db == nil {
+		return errors.New("nested transactions are not supported")
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(newModels(tx)); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
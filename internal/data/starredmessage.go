@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thisisjab/gchat-go/internal/filter"
+	"github.com/thisisjab/gchat-go/internal/validator"
+)
+
+type StarredMessage struct {
+	UserID           uuid.UUID            `json:"-"`
+	ConversationID   uuid.UUID            `json:"conversation_id"`
+	ConversationType string               `json:"conversation_type"`
+	Message          *ConversationMessage `json:"message"`
+	Note             *string              `json:"note"`
+	CreatedAt        time.Time            `json:"starred_at"`
+}
+
+type StarredMessageModel struct {
+	DB DBOperator
+}
+
+func ValidateStarredMessage(v *validator.Validator, sm *StarredMessage) {
+	v.Check(sm.Note == nil || len(*sm.Note) <= 500, "note", "must not be more than 500 bytes long")
+}
+
+// Star bookmarks the message for the user. Starring a message again replaces its note.
+func (smm *StarredMessageModel) Star(ctx context.Context, sm *StarredMessage) error {
+	query := `
+	INSERT INTO starred_messages (user_id, message_id, note)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, message_id) DO UPDATE SET note = EXCLUDED.note
+	RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return smm.DB.QueryRowContext(ctx, query, sm.UserID, sm.Message.ID, sm.Note).Scan(&sm.CreatedAt)
+}
+
+// Unstar removes the bookmark. ErrNoRecordFound is returned if the message was not starred.
+func (smm *StarredMessageModel) Unstar(ctx context.Context, userID, messageID uuid.UUID) error {
+	query := `DELETE FROM starred_messages WHERE user_id = $1 AND message_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := smm.DB.ExecContext(ctx, query, userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// GetAllForUser lists the messages starred by the user.
+// Messages of conversations the user no longer participates in, or cleared from their history, are left out.
+func (smm *StarredMessageModel) GetAllForUser(ctx context.Context, userID uuid.UUID, f filter.Filters) ([]*StarredMessage, *filter.PaginationMetadata, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		count(*) OVER(),
+		sm.note, sm.created_at AS starred_at,
+		c.id, c.type,
+		m.id, m.sender_id, m.type, m.format, m.content, m.payload, m.created_at, m.updated_at
+	FROM starred_messages sm
+	JOIN conversation_messages m ON m.id = sm.message_id
+	JOIN conversations c ON c.id = m.conversation_id
+	JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = sm.user_id
+	WHERE sm.user_id = $1 AND m.created_at > coalesce(
+		(SELECT p.cleared_at FROM conversation_preferences p WHERE p.conversation_id = c.id AND p.user_id = $1), '-infinity'
+	)
+	ORDER BY %s %s, sm.message_id ASC
+	LIMIT $2 OFFSET $3
+	`, f.SortColumn(), f.SortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := smm.DB.QueryContext(ctx, query, userID, f.Limit(), f.Offset())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	starred := make([]*StarredMessage, 0)
+	messages := make([]*ConversationMessage, 0)
+
+	for rows.Next() {
+		var (
+			sm      = StarredMessage{UserID: userID, Message: &ConversationMessage{}}
+			payload []byte
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&sm.Note,
+			&sm.CreatedAt,
+			&sm.ConversationID,
+			&sm.ConversationType,
+			&sm.Message.ID,
+			&sm.Message.SenderID,
+			&sm.Message.Type,
+			&sm.Message.Format,
+			&sm.Message.Content,
+			&payload,
+			&sm.Message.CreatedAt,
+			&sm.Message.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := sm.Message.setPayload(payload); err != nil {
+			return nil, nil, err
+		}
+
+		sm.Message.ConversationID = sm.ConversationID
+
+		starred = append(starred, &sm)
+		messages = append(messages, sm.Message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachPolls(ctx, smm.DB, userID, messages...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachContactUsers(ctx, smm.DB, messages...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := attachLinkPreviews(ctx, smm.DB, messages...); err != nil {
+		return nil, nil, err
+	}
+
+	paginationMetadata, err := filter.CalculatePaginationMetadata(totalRecords, f.Page, f.PageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return starred, paginationMetadata, nil
+}
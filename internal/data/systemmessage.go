@@ -0,0 +1,42 @@
+package data
+
+import (
+	"github.com/google/uuid"
+)
+
+const (
+	EventParticipantRemoved   = "participant_removed"
+	EventParticipantLeft      = "participant_left"
+	EventParticipantJoined    = "participant_joined"
+	EventParticipantAdded     = "participant_added"
+	EventOwnershipTransferred = "ownership_transferred"
+	EventGroupRenamed         = "group_renamed"
+	EventDescriptionChanged   = "description_changed"
+	EventAvatarChanged        = "avatar_changed"
+	EventVisibilityChanged    = "visibility_changed"
+	EventSettingsChanged      = "settings_changed"
+	EventParticipantBanned    = "participant_banned"
+	EventGroupCreated         = "group_created"
+)
+
+// SystemEvent describes what a system message records, so clients can render it in their own language.
+type SystemEvent struct {
+	Action   string     `json:"action"`
+	ActorID  uuid.UUID  `json:"actor_id"`
+	TargetID *uuid.UUID `json:"target_id,omitempty"`
+}
+
+// NewSystemMessage returns a system message recording that actor did action, optionally to target.
+// System messages are inserted by the server only and are never validated as client messages.
+func NewSystemMessage(conversationID, actorID uuid.UUID, action string, targetID *uuid.UUID) *ConversationMessage {
+	return &ConversationMessage{
+		ConversationID: conversationID,
+		Type:           TypeSystemMessage,
+		Format:         FormatPlain,
+		Event: &SystemEvent{
+			Action:   action,
+			ActorID:  actorID,
+			TargetID: targetID,
+		},
+	}
+}
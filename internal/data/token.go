@@ -41,19 +41,29 @@ func generateToken(userID uuid.UUID, ttl time.Duration, scope string) (*Token, e
 		Scope:  scope,
 	}
 
-	randomBytes := make([]byte, 16)
-
-	_, err := rand.Read(randomBytes)
+	plaintext, err := generateTokenPlaintext()
 	if err != nil {
 		return nil, err
 	}
 
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Plaintext = plaintext
 	token.Hash = hashToken(token.Plaintext)
 
 	return token, nil
 }
 
+// generateTokenPlaintext returns a random 26 bytes long code, used for tokens and other secrets only stored hashed.
+func generateTokenPlaintext() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -18,7 +18,7 @@ type UserModel struct {
 type User struct {
 	BaseModel
 	Username        string     `json:"username"`
-	Email           string     `json:"email"`
+	Email           string     `json:"email,omitempty"`
 	EmailVerifiedAt *time.Time `json:"-"`
 	Bio             *string    `json:"bio"`
 	IsActive        bool       `json:"is_active"`
@@ -299,3 +299,22 @@ func (m *UserModel) ExistsByID(ctx context.Context, id uuid.UUID) bool {
 
 	return err == nil
 }
+
+// lockUser locks the user until the end of the transaction, so concurrent transactions of the user checking a limit
+// wait for each other instead of all passing it at once. Limits should be counted in a separate statement after
+// locking, so the count sees the rows committed while waiting.
+func lockUser(ctx context.Context, db DBOperator, userID uuid.UUID) error {
+	query := `SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE`
+
+	err := db.QueryRowContext(ctx, query, userID).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoRecordFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -30,6 +30,10 @@ func (r *EnvReader) String(key, fallback string) string {
 func (r *EnvReader) Bool(key string, fallback bool) bool {
 	value := r.String(key, "")
 
+	if value == "" {
+		return fallback
+	}
+
 	if strings.EqualFold(value, "true") || strings.EqualFold(value, "1") {
 		return true
 	}
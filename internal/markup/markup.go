@@ -0,0 +1,351 @@
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"unicode"
+)
+
+const (
+	EntityBold    = "bold"
+	EntityItalic  = "italic"
+	EntityCode    = "code"
+	EntityPre     = "pre"
+	EntityLink    = "link"
+	EntitySpoiler = "spoiler"
+)
+
+// maxDepth limits how deep entities can be nested to keep parsing cheap.
+const maxDepth = 8
+
+// Entity describes a formatted range of the plain text. Offset and Length are counted in runes.
+type Entity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+var ErrInvalidLink = errors.New("contains an invalid link")
+
+// Parse parses a Markdown-like subset and returns the plain text along with its entities.
+//
+// Supported syntax is **bold**, _italic_, `code`, ```pre```, [text](url) and ||spoiler||.
+// A backslash escapes the next character, and markers without a closing counterpart are kept as is.
+// A closing marker closes the nearest open marker of its kind, and markers opened after that one are kept as is.
+//
+// The source is scanned once, so parsing takes time linear in its length.
+func Parse(src string) (string, []Entity, error) {
+	p := &parser{src: []rune(src), searches: make(map[string]search)}
+
+	if err := p.parse(); err != nil {
+		return "", nil, err
+	}
+
+	text, entities := p.render()
+
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+
+		return entities[i].Length > entities[j].Length
+	})
+
+	return string(text), entities, nil
+}
+
+// token is a piece of the source. Delimiters are kept as plain text unless they are matched.
+type token struct {
+	text       []rune // Plain text, the content of verbatim entities, or the marker of a delimiter.
+	entityType string // Empty for plain text.
+	verbatim   bool
+	matched    bool
+	closing    bool
+	url        string // Set on the closing delimiter of links, whose text is then the raw url.
+	language   string
+}
+
+// search is the result of the last search for a marker, which later searches from further on can reuse.
+type search struct {
+	from  int
+	found int
+}
+
+type parser struct {
+	src      []rune
+	pos      int
+	tokens   []token
+	openers  []int // Indexes of the tokens of unmatched opening delimiters, innermost last.
+	searches map[string]search
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return p.hasPrefixAt(p.pos, s)
+}
+
+func (p *parser) hasPrefixAt(pos int, s string) bool {
+	rs := []rune(s)
+
+	if pos+len(rs) > len(p.src) {
+		return false
+	}
+
+	for i, r := range rs {
+		if p.src[pos+i] != r {
+			return false
+		}
+	}
+
+	return true
+}
+
+// indexFrom returns the position of s at or after from, or -1.
+// Searches only move forward, so the previous result is reused while it's still ahead of from.
+func (p *parser) indexFrom(s string, from int) int {
+	if last, ok := p.searches[s]; ok && last.from <= from && (last.found == -1 || last.found >= from) {
+		return last.found
+	}
+
+	found := -1
+
+	for pos := from; pos < len(p.src); pos++ {
+		if p.hasPrefixAt(pos, s) {
+			found = pos
+			break
+		}
+	}
+
+	p.searches[s] = search{from: from, found: found}
+
+	return found
+}
+
+// parse splits the source into tokens, matching delimiters as their closing markers are found.
+func (p *parser) parse() error {
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == '\\' && p.pos+1 < len(p.src):
+			p.appendText(p.src[p.pos+1])
+			p.pos += 2
+
+		case p.hasPrefix("```"):
+			p.parseVerbatim("```", EntityPre)
+
+		case p.hasPrefix("`"):
+			p.parseVerbatim("`", EntityCode)
+
+		case p.hasPrefix("**"):
+			p.parseDelimiter("**", EntityBold, true)
+
+		case p.hasPrefix("||"):
+			p.parseDelimiter("||", EntitySpoiler, true)
+
+		case p.hasPrefix("_"):
+			p.parseDelimiter("_", EntityItalic, p.atWordStart())
+
+		case p.hasPrefix("["):
+			p.pos++
+			p.open("[", EntityLink)
+
+		case p.hasPrefix("]"):
+			if err := p.parseLinkEnd(); err != nil {
+				return err
+			}
+
+		default:
+			p.appendText(p.src[p.pos])
+			p.pos++
+		}
+	}
+
+	return nil
+}
+
+// appendText appends plain text, merging it into the previous token if that's plain text too.
+func (p *parser) appendText(rs ...rune) {
+	if n := len(p.tokens); n > 0 && p.tokens[n-1].entityType == "" {
+		p.tokens[n-1].text = append(p.tokens[n-1].text, rs...)
+		return
+	}
+
+	p.tokens = append(p.tokens, token{text: slices.Clone(rs)})
+}
+
+// atWordStart reports whether the current position is not preceded by a letter or digit,
+// so identifiers like snake_case are not treated as italic.
+func (p *parser) atWordStart() bool {
+	if p.pos == 0 {
+		return true
+	}
+
+	prev := p.src[p.pos-1]
+
+	return !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
+}
+
+// parseVerbatim handles code and pre entities whose content is not parsed any further.
+func (p *parser) parseVerbatim(marker, entityType string) {
+	size := len([]rune(marker))
+
+	end := p.indexFrom(marker, p.pos+size)
+	if end == -1 {
+		p.appendText(p.src[p.pos : p.pos+size]...)
+		p.pos += size
+
+		return
+	}
+
+	content := p.src[p.pos+size : end]
+	t := token{entityType: entityType, verbatim: true}
+
+	// A pre block may start with a language name on its own line, e.g. ```go\n...```.
+	if entityType == EntityPre {
+		for i, r := range content {
+			if r == '\n' {
+				t.language = string(content[:i])
+				content = content[i+1:]
+
+				break
+			}
+
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '-' && r != '#' {
+				break
+			}
+		}
+	}
+
+	if len(content) > 0 {
+		t.text = content
+		p.tokens = append(p.tokens, t)
+	}
+
+	p.pos = end + size
+}
+
+// parseDelimiter handles markers that both open and close entities whose content can contain other entities.
+// The marker closes the nearest open entity of its type if there is one, otherwise it opens one if canOpen.
+func (p *parser) parseDelimiter(marker, entityType string, canOpen bool) {
+	p.pos += len([]rune(marker))
+
+	if i := p.openerIndex(entityType); i != -1 {
+		p.close(i, token{entityType: entityType})
+		return
+	}
+
+	if canOpen {
+		p.open(marker, entityType)
+		return
+	}
+
+	p.appendText([]rune(marker)...)
+}
+
+// parseLinkEnd handles the ] of [text](url). Anything not matching the syntax is kept as plain text.
+func (p *parser) parseLinkEnd() error {
+	p.pos++
+
+	i := p.openerIndex(EntityLink)
+
+	end := -1
+	if i != -1 && p.hasPrefix("(") {
+		end = p.indexFrom(")", p.pos+1)
+	}
+
+	if end == -1 {
+		// The [ is kept as is, while entities opened after it can still be closed.
+		if i != -1 {
+			p.openers = slices.Delete(p.openers, i, i+1)
+		}
+
+		p.appendText(']')
+
+		return nil
+	}
+
+	rawURL := string(p.src[p.pos+1 : end])
+	p.pos = end + 1
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidLink, rawURL)
+	}
+
+	p.close(i, token{text: []rune(rawURL), entityType: EntityLink, url: u.String()})
+
+	return nil
+}
+
+// open adds an opening delimiter, unless entities are already nested too deep.
+func (p *parser) open(marker, entityType string) {
+	if len(p.openers) >= maxDepth {
+		p.appendText([]rune(marker)...)
+		return
+	}
+
+	p.openers = append(p.openers, len(p.tokens))
+	p.tokens = append(p.tokens, token{text: []rune(marker), entityType: entityType})
+}
+
+// openerIndex returns the index in openers of the nearest opening delimiter of the type, or -1.
+func (p *parser) openerIndex(entityType string) int {
+	for i := len(p.openers) - 1; i >= 0; i-- {
+		if p.tokens[p.openers[i]].entityType == entityType {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// close matches the opening delimiter at index i of openers with the closing token.
+// Delimiters opened after it are left unmatched, so entities are always properly nested.
+func (p *parser) close(i int, closing token) {
+	p.tokens[p.openers[i]].matched = true
+	p.openers = p.openers[:i]
+
+	closing.matched, closing.closing = true, true
+	p.tokens = append(p.tokens, closing)
+}
+
+// render returns the plain text of the tokens along with the entities of matched delimiters and verbatim tokens.
+func (p *parser) render() ([]rune, []Entity) {
+	var (
+		out      []rune
+		entities []Entity
+		starts   []int
+	)
+
+	for _, t := range p.tokens {
+		switch {
+		case t.verbatim:
+			entities = append(entities, Entity{Type: t.entityType, Offset: len(out), Length: len(t.text), Language: t.language})
+			out = append(out, t.text...)
+
+		case t.matched && !t.closing:
+			starts = append(starts, len(out))
+
+		case t.matched:
+			start := starts[len(starts)-1]
+			starts = starts[:len(starts)-1]
+
+			// A link without text shows the url itself.
+			if t.entityType == EntityLink && len(out) == start {
+				out = append(out, t.text...)
+			}
+
+			if len(out) > start {
+				entities = append(entities, Entity{Type: t.entityType, Offset: start, Length: len(out) - start, URL: t.url})
+			}
+
+		default:
+			out = append(out, t.text...)
+		}
+	}
+
+	return out, entities
+}
@@ -0,0 +1,174 @@
+package markup
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	link := func(offset, length int, url string) Entity {
+		return Entity{Type: EntityLink, Offset: offset, Length: length, URL: url}
+	}
+
+	tests := []struct {
+		name     string
+		src      string
+		text     string
+		entities []Entity
+	}{
+		{
+			name: "plain text",
+			src:  "hello",
+			text: "hello",
+		},
+		{
+			name:     "bold",
+			src:      "**hi** there",
+			text:     "hi there",
+			entities: []Entity{{Type: EntityBold, Offset: 0, Length: 2}},
+		},
+		{
+			name: "multi-byte offsets are counted in runes",
+			src:  "héllo **wörld** 👋 _ok_",
+			text: "héllo wörld 👋 ok",
+			entities: []Entity{
+				{Type: EntityBold, Offset: 6, Length: 5},
+				{Type: EntityItalic, Offset: 14, Length: 2},
+			},
+		},
+		{
+			name: "nested entities are ordered by offset, outermost first",
+			src:  "||a **b**||",
+			text: "a b",
+			entities: []Entity{
+				{Type: EntitySpoiler, Offset: 0, Length: 3},
+				{Type: EntityBold, Offset: 2, Length: 1},
+			},
+		},
+		{
+			name: "unclosed marker is kept as is",
+			src:  "**bold",
+			text: "**bold",
+		},
+		{
+			name: "unclosed code is kept as is",
+			src:  "`code",
+			text: "`code",
+		},
+		{
+			name:     "overlapping markers leave the inner one as is",
+			src:      "**a _b** c_",
+			text:     "a _b c_",
+			entities: []Entity{{Type: EntityBold, Offset: 0, Length: 4}},
+		},
+		{
+			name: "underscores inside words are not italic",
+			src:  "snake_case_name",
+			text: "snake_case_name",
+		},
+		{
+			name: "escaped markers",
+			src:  `\*\*x\*\*`,
+			text: "**x**",
+		},
+		{
+			name:     "code content is not parsed",
+			src:      "`**not bold**`",
+			text:     "**not bold**",
+			entities: []Entity{{Type: EntityCode, Offset: 0, Length: 12}},
+		},
+		{
+			name:     "pre with a language",
+			src:      "```go\nfmt.Println()```",
+			text:     "fmt.Println()",
+			entities: []Entity{{Type: EntityPre, Offset: 0, Length: 13, Language: "go"}},
+		},
+		{
+			name:     "link",
+			src:      "see [site](https://example.com)",
+			text:     "see site",
+			entities: []Entity{link(4, 4, "https://example.com")},
+		},
+		{
+			name:     "link without text shows the url",
+			src:      "[](https://example.com)",
+			text:     "https://example.com",
+			entities: []Entity{link(0, 19, "https://example.com")},
+		},
+		{
+			name: "brackets without a url are kept as is",
+			src:  "[not a link] **b**",
+			text: "[not a link] b",
+			entities: []Entity{
+				{Type: EntityBold, Offset: 13, Length: 1},
+			},
+		},
+		{
+			name:     "markers nested deeper than the limit are kept as is",
+			src:      strings.Repeat("[", maxDepth+1) + "x" + strings.Repeat("](https://a.example)", maxDepth+1),
+			text:     "[x](https://a.example)",
+			entities: slices.Repeat([]Entity{link(0, 2, "https://a.example")}, maxDepth),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if text != tt.text {
+				t.Errorf("got text %q, want %q", text, tt.text)
+			}
+
+			if len(entities) != 0 || len(tt.entities) != 0 {
+				if !reflect.DeepEqual(entities, tt.entities) {
+					t.Errorf("got entities %+v, want %+v", entities, tt.entities)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidLinks(t *testing.T) {
+	tests := []string{
+		"[x](javascript:alert(1))",
+		"[x](JavaScript:alert(1))",
+		"[x](data:text/html,hi)",
+		"[x](ftp://example.com)",
+		"[x](https://)",
+		"[x](/relative)",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if _, _, err := Parse(src); !errors.Is(err, ErrInvalidLink) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidLink)
+			}
+		})
+	}
+}
+
+func TestParseIsLinear(t *testing.T) {
+	for _, src := range []string{
+		strings.Repeat("[", 100_000),
+		strings.Repeat("**_", 100_000),
+		strings.Repeat("`", 100_000),
+		strings.Repeat("[x](", 100_000),
+	} {
+		start := time.Now()
+
+		if _, _, err := Parse(src); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("parsing %d runes took %s", len(src), elapsed)
+		}
+	}
+}
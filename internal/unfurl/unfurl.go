@@ -0,0 +1,308 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Metadata is the Open Graph / Twitter Card data found in a page.
+type Metadata struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// Fetcher fetches the metadata of a page.
+// It's an interface so the HTTP implementation can be swapped, e.g. with one hitting an httptest.Server.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*Metadata, error)
+}
+
+type Config struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	MaxRedirects int
+
+	// Resolve and Dial replace DNS resolution and dialing, e.g. to reach an httptest.Server in tests.
+	// Resolved addresses are checked before they are dialed either way.
+	// They default to the system resolver and a net.Dialer.
+	Resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+	Dial    func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+var (
+	ErrBlockedAddress   = errors.New("address is not allowed")
+	ErrUnsupportedURL   = errors.New("unsupported url")
+	ErrUnsupportedPage  = errors.New("page is not html")
+	ErrNoMetadata       = errors.New("page has no metadata")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// blockedPrefixes are ranges not covered by the netip helpers that must never be fetched.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// HTTPFetcher fetches pages over HTTP while guarding against SSRF:
+// only http(s) on default ports is allowed and connections to private, loopback
+// and other internal addresses are refused after DNS resolution (which also covers redirects).
+// A host is refused if any of its addresses is not public.
+type HTTPFetcher struct {
+	client       *http.Client
+	maxBodyBytes int64
+}
+
+func NewHTTPFetcher(cfg Config) *HTTPFetcher {
+	if cfg.Resolve == nil {
+		cfg.Resolve = func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		}
+	}
+
+	if cfg.Dial == nil {
+		cfg.Dial = (&net.Dialer{Timeout: cfg.Timeout}).DialContext
+	}
+
+	transport := &http.Transport{
+		// Proxies are ignored on purpose since they would bypass the address checks.
+		Proxy:                 nil,
+		DialContext:           dialPublic(cfg.Resolve, cfg.Dial),
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       time.Minute,
+	}
+
+	return &HTTPFetcher{
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > cfg.MaxRedirects {
+					return ErrTooManyRedirects
+				}
+
+				return checkURL(req.URL)
+			},
+		},
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*Metadata, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "GTalkBot/1.0 (link preview)")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrUnsupportedPage
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, f.maxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// The final url is used so relative images resolve correctly after redirects.
+	return Parse(res.Request.URL, string(body))
+}
+
+// dialPublic returns a dial function which resolves the host itself and only dials public addresses.
+// The checked address is dialed rather than the host, so DNS can't answer differently in between.
+func dialPublic(resolve func(context.Context, string) ([]netip.Addr, error), dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		var addrs []netip.Addr
+
+		if addr, err := netip.ParseAddr(host); err == nil {
+			addrs = []netip.Addr{addr}
+		} else if addrs, err = resolve(ctx, host); err != nil {
+			return nil, err
+		}
+
+		var dialErr error
+
+		for _, addr := range addrs {
+			if !isPublicAddr(addr) {
+				return nil, fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+			}
+		}
+
+		for _, addr := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+
+			dialErr = err
+		}
+
+		if dialErr == nil {
+			dialErr = fmt.Errorf("no addresses found for %s", host)
+		}
+
+		return nil, dialErr
+	}
+}
+
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedURL
+	}
+
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return ErrUnsupportedURL
+	}
+
+	if u.User != nil {
+		return ErrUnsupportedURL
+	}
+
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var (
+	metaTagRX   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributeRX = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleTagRX  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// Parse extracts metadata from an HTML document served at pageURL.
+// Open Graph tags take precedence over Twitter Card tags, which take precedence over plain HTML.
+func Parse(pageURL *url.URL, document string) (*Metadata, error) {
+	tags := make(map[string]string)
+
+	for _, tag := range metaTagRX.FindAllString(document, -1) {
+		var key, content string
+
+		for _, attr := range attributeRX.FindAllStringSubmatch(tag, -1) {
+			value := html.UnescapeString(attr[2] + attr[3])
+
+			switch strings.ToLower(attr[1]) {
+			case "property", "name":
+				key = strings.ToLower(value)
+			case "content":
+				content = strings.TrimSpace(value)
+			}
+		}
+
+		if _, found := tags[key]; key != "" && content != "" && !found {
+			tags[key] = content
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if tags[key] != "" {
+				return tags[key]
+			}
+		}
+
+		return ""
+	}
+
+	m := &Metadata{
+		URL:         pageURL.String(),
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		ImageURL:    first("og:image", "og:image:url", "twitter:image", "twitter:image:src"),
+		SiteName:    first("og:site_name"),
+	}
+
+	if m.Title == "" {
+		if match := titleTagRX.FindStringSubmatch(document); match != nil {
+			m.Title = strings.TrimSpace(html.UnescapeString(match[1]))
+		}
+	}
+
+	if m.ImageURL != "" {
+		image, err := pageURL.Parse(m.ImageURL)
+		if err != nil || (image.Scheme != "http" && image.Scheme != "https") {
+			m.ImageURL = ""
+		} else {
+			m.ImageURL = image.String()
+		}
+	}
+
+	if m.Title == "" && m.Description == "" && m.ImageURL == "" {
+		return nil, ErrNoMetadata
+	}
+
+	return m, nil
+}
+
+var urlRX = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// ExtractURLs returns the http(s) urls found in text, without trailing punctuation.
+func ExtractURLs(text string) []string {
+	urls := urlRX.FindAllString(text, -1)
+
+	for i, u := range urls {
+		urls[i] = strings.TrimRight(u, ".,;:!?)]}")
+	}
+
+	return urls
+}
@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS message_poll_votes;
+
+DROP TABLE IF EXISTS message_poll_options;
+
+DROP TABLE IF EXISTS message_polls;
+
+-- Postgres can't drop a value from an enum, so the type is recreated without it.
+UPDATE conversation_messages SET replied_message_id = NULL
+WHERE replied_message_id IN (SELECT id FROM conversation_messages WHERE type = 'poll');
+
+DELETE FROM conversation_messages WHERE type = 'poll';
+
+ALTER TYPE message_type RENAME TO message_type_old;
+
+CREATE TYPE message_type AS ENUM ('text', 'image', 'video', 'audio', 'file');
+
+ALTER TABLE conversation_messages ALTER COLUMN type TYPE message_type USING type::text::message_type;
+
+DROP TYPE message_type_old;
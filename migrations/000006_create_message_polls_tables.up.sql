@@ -0,0 +1,29 @@
+ALTER TYPE message_type ADD VALUE IF NOT EXISTS 'poll';
+
+CREATE TABLE IF NOT EXISTS message_polls (
+    message_id UUID PRIMARY KEY REFERENCES conversation_messages (id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    is_multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    is_anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMPTZ,
+    closed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS message_poll_options (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    message_id UUID NOT NULL REFERENCES message_polls (message_id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    text TEXT NOT NULL,
+    CONSTRAINT unique_poll_option_position UNIQUE (message_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS message_poll_votes (
+    message_id UUID NOT NULL REFERENCES message_polls (message_id) ON DELETE CASCADE,
+    option_id UUID NOT NULL REFERENCES message_poll_options (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    -- Check each user votes for an option at most once
+    CONSTRAINT unique_poll_vote UNIQUE (option_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS message_poll_votes_message_id_user_id_idx ON message_poll_votes (message_id, user_id);
@@ -0,0 +1,15 @@
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS payload;
+
+-- Postgres can't drop a value from an enum, so the type is recreated without them.
+UPDATE conversation_messages SET replied_message_id = NULL
+WHERE replied_message_id IN (SELECT id FROM conversation_messages WHERE type IN ('location', 'contact'));
+
+DELETE FROM conversation_messages WHERE type IN ('location', 'contact');
+
+ALTER TYPE message_type RENAME TO message_type_old;
+
+CREATE TYPE message_type AS ENUM ('text', 'image', 'video', 'audio', 'file', 'poll');
+
+ALTER TABLE conversation_messages ALTER COLUMN type TYPE message_type USING type::text::message_type;
+
+DROP TYPE message_type_old;
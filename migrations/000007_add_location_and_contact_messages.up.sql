@@ -0,0 +1,6 @@
+ALTER TYPE message_type ADD VALUE IF NOT EXISTS 'location';
+
+ALTER TYPE message_type ADD VALUE IF NOT EXISTS 'contact';
+
+-- Structured data of message types that don't fit in content (e.g. location, contact).
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS payload JSONB;
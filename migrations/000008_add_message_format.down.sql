@@ -0,0 +1,3 @@
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS format;
+
+DROP TYPE IF EXISTS message_format;
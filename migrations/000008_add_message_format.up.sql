@@ -0,0 +1,4 @@
+CREATE TYPE message_format AS ENUM ('plain', 'markdown');
+
+-- Formatted messages store plain text in content and their entities in payload.
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS format message_format NOT NULL DEFAULT 'plain';
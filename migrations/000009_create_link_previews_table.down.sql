@@ -0,0 +1,3 @@
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS link_preview_url;
+
+DROP TABLE IF EXISTS link_previews;
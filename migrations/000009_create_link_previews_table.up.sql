@@ -0,0 +1,11 @@
+-- Cache of unfurled links, shared by all messages containing the same url.
+CREATE TABLE IF NOT EXISTS link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT,
+    description TEXT,
+    image_url TEXT,
+    site_name TEXT,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+);
+
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS link_preview_url TEXT REFERENCES link_previews (url) ON DELETE SET NULL;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS starred_messages (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES conversation_messages (id) ON DELETE CASCADE,
+    note TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (user_id, message_id)
+);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS self_conversations;
+
+-- Postgres can't drop a value from an enum, so the type is recreated without it.
+DELETE FROM conversations WHERE type = 'self';
+
+ALTER TYPE conversation_type RENAME TO conversation_type_old;
+
+CREATE TYPE conversation_type AS ENUM ('private', 'group');
+
+ALTER TABLE conversations ALTER COLUMN type TYPE conversation_type USING type::text::conversation_type;
+
+DROP TYPE conversation_type_old;
@@ -0,0 +1,7 @@
+ALTER TYPE conversation_type ADD VALUE IF NOT EXISTS 'self';
+
+-- Each user has at most one "saved messages" conversation with themselves.
+CREATE TABLE IF NOT EXISTS self_conversations (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL UNIQUE REFERENCES conversations (id) ON DELETE CASCADE
+);
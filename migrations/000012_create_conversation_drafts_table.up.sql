@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS conversation_drafts (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    format message_format NOT NULL DEFAULT 'plain',
+    replied_message_id UUID REFERENCES conversation_messages (id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (user_id, conversation_id)
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS conversation_messages_sender_id_client_message_id_key;
+
+ALTER TABLE conversation_messages DROP COLUMN IF EXISTS client_message_id;
+
+DROP TABLE IF EXISTS idempotency_keys;
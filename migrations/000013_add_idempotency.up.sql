@@ -0,0 +1,16 @@
+-- Responses of requests sent with an Idempotency-Key header, replayed when the request is retried.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    request_hash bytea NOT NULL,
+    -- Both are NULL while the original request is still being processed.
+    status_code INTEGER,
+    response_body bytea,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (user_id, key)
+);
+
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS client_message_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS conversation_messages_sender_id_client_message_id_key ON conversation_messages (sender_id, client_message_id)
+WHERE client_message_id IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Sequence-numbered log of changes used by clients to sync what changed since they were last online.
+-- conversation_id intentionally has no foreign key so changes of deleted conversations can still be synced.
+CREATE TABLE IF NOT EXISTS change_log (
+    seq BIGSERIAL PRIMARY KEY,
+    conversation_id UUID NOT NULL,
+    entity TEXT NOT NULL,
+    entity_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    -- Set for membership changes so removed users are told about their removal.
+    user_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+);
+
+CREATE INDEX IF NOT EXISTS change_log_conversation_id_seq_idx ON change_log (conversation_id, seq);
+
+CREATE INDEX IF NOT EXISTS change_log_user_id_seq_idx ON change_log (user_id, seq) WHERE user_id IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS role;
+
+DROP TYPE IF EXISTS participant_role;
@@ -0,0 +1,7 @@
+CREATE TYPE participant_role AS ENUM ('owner', 'admin', 'member');
+
+ALTER TABLE conversation_participants ADD COLUMN IF NOT EXISTS role participant_role NOT NULL DEFAULT 'member';
+
+UPDATE conversation_participants cp SET role = 'owner'
+FROM group_metadata gm
+WHERE gm.conversation_id = cp.conversation_id AND gm.owner_id = cp.user_id;
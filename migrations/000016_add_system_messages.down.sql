@@ -0,0 +1,13 @@
+-- Postgres can't drop a value from an enum, so the type is recreated without it.
+UPDATE conversation_messages SET replied_message_id = NULL
+WHERE replied_message_id IN (SELECT id FROM conversation_messages WHERE type = 'system');
+
+DELETE FROM conversation_messages WHERE type = 'system';
+
+ALTER TYPE message_type RENAME TO message_type_old;
+
+CREATE TYPE message_type AS ENUM ('text', 'image', 'video', 'audio', 'file', 'poll', 'location', 'contact');
+
+ALTER TABLE conversation_messages ALTER COLUMN type TYPE message_type USING type::text::message_type;
+
+DROP TYPE message_type_old;
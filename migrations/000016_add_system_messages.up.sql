@@ -0,0 +1,2 @@
+-- System messages are inserted by the server to record events like membership changes.
+ALTER TYPE message_type ADD VALUE IF NOT EXISTS 'system';
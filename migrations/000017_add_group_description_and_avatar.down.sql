@@ -0,0 +1,3 @@
+ALTER TABLE group_metadata DROP COLUMN IF EXISTS avatar_url;
+
+ALTER TABLE group_metadata DROP COLUMN IF EXISTS description;
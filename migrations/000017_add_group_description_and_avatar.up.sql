@@ -0,0 +1,3 @@
+ALTER TABLE group_metadata ADD COLUMN IF NOT EXISTS description TEXT;
+
+ALTER TABLE group_metadata ADD COLUMN IF NOT EXISTS avatar_url TEXT;
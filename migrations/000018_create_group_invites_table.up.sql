@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS group_invites (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    -- Only the hash of the invite code is stored, like tokens.
+    hash bytea NOT NULL UNIQUE,
+    conversation_id UUID NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    created_by UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ,
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+);
+
+CREATE INDEX IF NOT EXISTS group_invites_conversation_id_idx ON group_invites (conversation_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS group_join_requests;
+
+DROP TYPE IF EXISTS join_request_status;
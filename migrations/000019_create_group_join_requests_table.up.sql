@@ -0,0 +1,18 @@
+CREATE TYPE join_request_status AS ENUM ('pending', 'approved', 'rejected', 'expired');
+
+CREATE TABLE IF NOT EXISTS group_join_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    conversation_id UUID NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    invite_id UUID REFERENCES group_invites (id) ON DELETE SET NULL,
+    message TEXT,
+    status join_request_status NOT NULL DEFAULT 'pending',
+    decided_by UUID REFERENCES users (id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+);
+
+-- A user can only have one pending request per group.
+CREATE UNIQUE INDEX IF NOT EXISTS group_join_requests_pending_key ON group_join_requests (conversation_id, user_id) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS group_join_requests_user_id_created_at_idx ON group_join_requests (user_id, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE group_metadata DROP COLUMN IF EXISTS visibility;
+
+DROP TYPE IF EXISTS group_visibility;
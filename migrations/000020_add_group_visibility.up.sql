@@ -0,0 +1,5 @@
+CREATE TYPE group_visibility AS ENUM ('private', 'public');
+
+ALTER TABLE group_metadata ADD COLUMN IF NOT EXISTS visibility group_visibility NOT NULL DEFAULT 'private';
+
+CREATE INDEX IF NOT EXISTS group_metadata_public_idx ON group_metadata (conversation_id) WHERE visibility = 'public';
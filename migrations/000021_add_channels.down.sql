@@ -0,0 +1,12 @@
+DELETE FROM conversations WHERE type = 'channel';
+
+ALTER TABLE group_metadata DROP COLUMN IF EXISTS member_count;
+
+-- Postgres can't drop a value from an enum, so the type is recreated without it.
+ALTER TYPE conversation_type RENAME TO conversation_type_old;
+
+CREATE TYPE conversation_type AS ENUM ('private', 'group', 'self');
+
+ALTER TABLE conversations ALTER COLUMN type TYPE conversation_type USING type::text::conversation_type;
+
+DROP TYPE conversation_type_old;
@@ -0,0 +1,5 @@
+-- Channels are one-to-many conversations where only owners and admins post, sharing group metadata.
+ALTER TYPE conversation_type ADD VALUE IF NOT EXISTS 'channel';
+
+-- Channels can have very many subscribers, so their count is maintained rather than counted.
+ALTER TABLE group_metadata ADD COLUMN IF NOT EXISTS member_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS conversation_messages_conversation_id_sender_id_created_at_idx;
+
+ALTER TABLE group_metadata
+    DROP COLUMN IF EXISTS send_messages,
+    DROP COLUMN IF EXISTS send_media,
+    DROP COLUMN IF EXISTS add_members,
+    DROP COLUMN IF EXISTS slow_mode_interval;
+
+DROP TYPE IF EXISTS group_audience;
@@ -0,0 +1,11 @@
+CREATE TYPE group_audience AS ENUM ('everyone', 'admins');
+
+ALTER TABLE group_metadata
+    ADD COLUMN IF NOT EXISTS send_messages group_audience NOT NULL DEFAULT 'everyone',
+    ADD COLUMN IF NOT EXISTS send_media group_audience NOT NULL DEFAULT 'everyone',
+    ADD COLUMN IF NOT EXISTS add_members group_audience NOT NULL DEFAULT 'admins',
+    -- Minimum number of seconds between messages of a member, 0 when slow mode is off.
+    ADD COLUMN IF NOT EXISTS slow_mode_interval INTEGER NOT NULL DEFAULT 0;
+
+-- Used to find when a member last posted to enforce slow mode.
+CREATE INDEX IF NOT EXISTS conversation_messages_conversation_id_sender_id_created_at_idx ON conversation_messages (conversation_id, sender_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS group_restrictions;
+
+DROP TYPE IF EXISTS group_restriction_type;
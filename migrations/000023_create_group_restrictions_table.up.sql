@@ -0,0 +1,14 @@
+CREATE TYPE group_restriction_type AS ENUM ('mute', 'ban');
+
+-- Muted members can read but not post, banned users are removed and can't rejoin until unbanned.
+CREATE TABLE IF NOT EXISTS group_restrictions (
+    conversation_id UUID NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type group_restriction_type NOT NULL,
+    reason TEXT,
+    created_by UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- NULL while the restriction lasts until it's lifted.
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (conversation_id, user_id, type)
+);
@@ -0,0 +1,13 @@
+ALTER TABLE conversation_messages DROP CONSTRAINT IF EXISTS conversation_messages_sender_id_check;
+
+UPDATE conversation_messages m SET sender_id = u.id
+FROM users u
+WHERE m.type = 'system' AND u.id = (m.payload -> 'event' ->> 'actor_id')::uuid;
+
+-- System messages whose actor has been deleted can't get a sender back.
+UPDATE conversation_messages SET replied_message_id = NULL
+WHERE replied_message_id IN (SELECT id FROM conversation_messages WHERE sender_id IS NULL);
+
+DELETE FROM conversation_messages WHERE sender_id IS NULL;
+
+ALTER TABLE conversation_messages ALTER COLUMN sender_id SET NOT NULL;
@@ -0,0 +1,6 @@
+-- System messages aren't sent by any user, their actor is recorded in their event instead.
+ALTER TABLE conversation_messages ALTER COLUMN sender_id DROP NOT NULL;
+
+UPDATE conversation_messages SET sender_id = NULL WHERE type = 'system';
+
+ALTER TABLE conversation_messages ADD CONSTRAINT conversation_messages_sender_id_check CHECK ((sender_id IS NULL) = (type = 'system'));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS conversation_messages_conversation_id_created_at_id_idx;
+
+ALTER TABLE conversations DROP COLUMN IF EXISTS last_message_id;
@@ -0,0 +1,14 @@
+-- Member counts of groups are now maintained like those of channels, rather than counted.
+UPDATE group_metadata gm
+SET member_count = (SELECT count(*) FROM conversation_participants cp WHERE cp.conversation_id = gm.conversation_id);
+
+-- Pointer to the latest message, so listing conversations doesn't look it up for each of them.
+-- It has no foreign key since messages already reference their conversation, which would make deletes cascade in a cycle.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_id UUID;
+
+UPDATE conversations c
+SET last_message_id = (
+    SELECT m.id FROM conversation_messages m WHERE m.conversation_id = c.id ORDER BY m.created_at DESC, m.id LIMIT 1
+);
+
+CREATE INDEX IF NOT EXISTS conversation_messages_conversation_id_created_at_id_idx ON conversation_messages (conversation_id, created_at DESC, id);
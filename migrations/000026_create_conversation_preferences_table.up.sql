@@ -0,0 +1,14 @@
+-- Settings of a participant for a conversation, which only affect how it's shown to them.
+-- Participants without a row have the defaults, and the row is removed along with the participant.
+CREATE TABLE IF NOT EXISTS conversation_preferences (
+    conversation_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    muted_until TIMESTAMPTZ,
+    pinned_at TIMESTAMPTZ,
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id, user_id) REFERENCES conversation_participants (conversation_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversation_preferences_user_id_pinned_at_idx ON conversation_preferences (user_id, pinned_at) WHERE pinned_at IS NOT NULL;
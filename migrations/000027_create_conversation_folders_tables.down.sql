@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS conversation_folder_conversations;
+
+DROP TABLE IF EXISTS conversation_folders;
+
+ALTER TABLE conversation_preferences DROP COLUMN IF EXISTS last_read_message_id;
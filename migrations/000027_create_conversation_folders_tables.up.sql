@@ -0,0 +1,33 @@
+-- The latest message a participant read, so conversations with newer messages are unread.
+-- Participants who never marked a conversation as read don't track it, so it's never unread for them.
+ALTER TABLE conversation_preferences ADD COLUMN IF NOT EXISTS last_read_message_id UUID;
+
+-- Folders group the conversations of a user, both by rules and manually.
+CREATE TABLE IF NOT EXISTS conversation_folders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    include_types conversation_type[] NOT NULL DEFAULT '{}',
+    include_unread BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    version INTEGER NOT NULL DEFAULT 1,
+    -- Referenced along with the user so folders only contain conversations of their owner.
+    UNIQUE (id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS conversation_folders_user_id_position_idx ON conversation_folders (user_id, position);
+
+-- Conversations added to folders manually, which are removed when the user leaves them.
+CREATE TABLE IF NOT EXISTS conversation_folder_conversations (
+    folder_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    conversation_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (folder_id, conversation_id),
+    FOREIGN KEY (folder_id, user_id) REFERENCES conversation_folders (id, user_id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id, user_id) REFERENCES conversation_participants (conversation_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversation_folder_conversations_conversation_id_user_id_idx ON conversation_folder_conversations (conversation_id, user_id);
@@ -0,0 +1,7 @@
+DELETE FROM conversations WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS conversations_deleted_at_idx;
+
+ALTER TABLE conversations DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE conversation_preferences DROP COLUMN IF EXISTS cleared_at;
@@ -0,0 +1,7 @@
+-- Messages up to this time are hidden from the participant, who cleared the history of the conversation for themselves.
+ALTER TABLE conversation_preferences ADD COLUMN IF NOT EXISTS cleared_at TIMESTAMPTZ;
+
+-- Deleted conversations lose their participants right away, and the rest is purged in batches in the background.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS conversations_deleted_at_idx ON conversations (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Urls that could not be unfurled, so they are not fetched again for every message until failed_at is old enough.
+CREATE TABLE IF NOT EXISTS link_preview_failures (
+    url TEXT PRIMARY KEY,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+);
@@ -0,0 +1,2 @@
+-- Expired keys are purged periodically by their age.
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
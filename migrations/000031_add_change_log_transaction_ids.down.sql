@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS change_log_user_id_txid_seq_idx;
+
+DROP INDEX IF EXISTS change_log_conversation_id_txid_seq_idx;
+
+CREATE INDEX IF NOT EXISTS change_log_conversation_id_seq_idx ON change_log (conversation_id, seq);
+
+CREATE INDEX IF NOT EXISTS change_log_user_id_seq_idx ON change_log (user_id, seq) WHERE user_id IS NOT NULL;
+
+ALTER TABLE change_log DROP COLUMN IF EXISTS txid;
@@ -0,0 +1,13 @@
+-- Changes are read in the order of the transactions that wrote them, and only once no earlier transaction can still commit.
+-- Existing changes were written in order under a lock, so they all get the lowest transaction id and keep their order.
+ALTER TABLE change_log ADD COLUMN IF NOT EXISTS txid xid8 NOT NULL DEFAULT '0';
+
+ALTER TABLE change_log ALTER COLUMN txid SET DEFAULT pg_current_xact_id ();
+
+DROP INDEX IF EXISTS change_log_conversation_id_seq_idx;
+
+DROP INDEX IF EXISTS change_log_user_id_seq_idx;
+
+CREATE INDEX IF NOT EXISTS change_log_conversation_id_txid_seq_idx ON change_log (conversation_id, txid, seq);
+
+CREATE INDEX IF NOT EXISTS change_log_user_id_txid_seq_idx ON change_log (user_id, txid, seq) WHERE user_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_decrement_member_counts ON users;
+
+DROP FUNCTION IF EXISTS decrement_member_counts_of_deleted_user;
@@ -0,0 +1,15 @@
+-- Deleting a user removes their memberships through ON DELETE CASCADE, which bypasses the member counts kept by the application.
+CREATE OR REPLACE FUNCTION decrement_member_counts_of_deleted_user () RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE group_metadata gm
+    SET member_count = gm.member_count - 1
+    FROM conversation_participants cp
+    WHERE cp.user_id = OLD.id AND cp.conversation_id = gm.conversation_id;
+
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER users_decrement_member_counts
+BEFORE DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION decrement_member_counts_of_deleted_user ();
@@ -0,0 +1,11 @@
+ALTER TABLE conversation_preferences ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE conversation_preferences p
+SET archived = TRUE
+FROM conversations c
+WHERE c.id = p.conversation_id AND p.archived_at IS NOT NULL AND (
+    p.muted_until > NOW() OR
+    p.archived_at >= coalesce((SELECT m.created_at FROM conversation_messages m WHERE m.id = c.last_message_id), '-infinity')
+);
+
+ALTER TABLE conversation_preferences DROP COLUMN IF EXISTS archived_at;
@@ -0,0 +1,7 @@
+-- Conversations are archived as of a time, and are only archived as long as their latest message is older.
+-- This way new messages bring them back to the inbox without updating every participant's preferences.
+ALTER TABLE conversation_preferences ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+UPDATE conversation_preferences SET archived_at = NOW() WHERE archived;
+
+ALTER TABLE conversation_preferences DROP COLUMN IF EXISTS archived;